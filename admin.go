@@ -0,0 +1,387 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	GOSESSION_ADMIN_PAGE_SIZE     int    = 50           // Default number of sessions on the page of the admin handler
+	GOSESSION_ADMIN_MAX_PAGE_SIZE int    = 500          // Maximum number of sessions on the page of the admin handler
+	GOSESSION_ADMIN_REDACTED      string = "[redacted]" // Shown instead of the hidden values of session variables
+)
+
+// The AdminAction type is the action of the admin handler that is being authorized
+type AdminAction string
+
+const (
+	GOSESSION_ADMIN_LIST    AdminAction = "list"    // Listing the sessions
+	GOSESSION_ADMIN_VIEW    AdminAction = "view"    // Viewing the variables of one session
+	GOSESSION_ADMIN_DESTROY AdminAction = "destroy" // Destroying one session
+)
+
+// The AdminSetings type describes the settings of the admin handler
+type AdminSetings struct {
+	Authorize  func(r *http.Request, action AdminAction) bool // Decides whether the request may perform the action, nil - all requests are rejected
+	RedactKeys []string                                       // Names of the variables whose values are hidden, "prefix*" hides by prefix, "*" hides all values
+	PageSize   int                                            // Default number of sessions on the page, GOSESSION_ADMIN_PAGE_SIZE if zero
+}
+
+// The AdminSession type describes the session in the admin handler
+type AdminSession struct {
+	SessionInfo
+	Size int64                  // Approximate size of the session in memory
+	Keys []string               // Names of the session variables
+	Data map[string]interface{} `json:",omitempty"` // Values of the session variables, only for one session
+}
+
+// The AdminPage type is the page of the list of sessions
+type AdminPage struct {
+	Sessions []AdminSession
+	Total    int    // Number of sessions matching the filter
+	Next     string // Cursor of the next page, empty on the last page
+}
+
+// The AdminHandler type is the http.Handler for inspecting and destroying sessions.
+// Routes relative to the mount point:
+// GET / - HTML list; GET /session/{handle} - HTML view; POST /session/{handle}/destroy - destroy from the HTML view;
+// GET /api/sessions - JSON list; GET /api/sessions/{handle} - JSON view; DELETE /api/sessions/{handle} - destroy.
+// The list accepts the user, ip, key (has the variable), cursor and limit query parameters.
+type AdminHandler struct {
+	setings AdminSetings
+}
+
+// The adminFilter type selects the sessions in the list
+type adminFilter struct {
+	userId string
+	ip     string
+	key    string
+	cursor string
+	limit  int
+}
+
+// The NewAdminHandler(setings) function creates the admin handler, mount it with http.StripPrefix() and a trailing slash:
+// http.Handle("/admin/sessions/", http.StripPrefix("/admin/sessions", gosession.NewAdminHandler(setings))).
+// setings - gosession.AdminSetings public type variable with the authorization callback.
+func NewAdminHandler(setings AdminSetings) *AdminHandler {
+	if setings.PageSize <= 0 {
+		setings.PageSize = GOSESSION_ADMIN_PAGE_SIZE
+	}
+	if setings.PageSize > GOSESSION_ADMIN_MAX_PAGE_SIZE {
+		setings.PageSize = GOSESSION_ADMIN_MAX_PAGE_SIZE
+	}
+	return &AdminHandler{setings: setings}
+}
+
+// The redacted(name) AdminSetings-method reports whether the value of the variable must be hidden
+func (as AdminSetings) redacted(name string) bool {
+	for _, rule := range as.RedactKeys {
+		if strings.HasSuffix(rule, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(rule, "*")) {
+				return true
+			}
+		} else if name == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// The adminValue(v) function returns the value as is if it can be encoded to JSON, otherwise its text representation
+func adminValue(v interface{}) interface{} {
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return v
+}
+
+// The adminSession(key, ses, withData) AdminHandler-method describes the session, the values of variables are redacted
+func (ah *AdminHandler) adminSession(key SessionId, ses internalSession, withData bool) AdminSession {
+	live := ses.liveData(clockNow().UnixNano())
+	as := AdminSession{
+		SessionInfo: ses.info(key, ""),
+		Size:        ses.size,
+		Keys:        make([]string, 0, len(live)),
+	}
+	for name := range live {
+		as.Keys = append(as.Keys, name)
+	}
+	sort.Strings(as.Keys)
+	if withData {
+		as.Data = make(map[string]interface{}, len(live))
+		for name, value := range live {
+			if ah.setings.redacted(name) {
+				as.Data[name] = GOSESSION_ADMIN_REDACTED
+			} else {
+				as.Data[name] = adminValue(value)
+			}
+		}
+	}
+	return as
+}
+
+// The listS(filter) AdminHandler-method safely selects the page of live sessions in memory ordered by their handles
+func (ah *AdminHandler) listS(filter adminFilter) AdminPage {
+	now := clockNow()
+	presently := now.Unix()
+	block.RLock()
+	matched := make([]AdminSession, 0)
+	for key, ses := range allSessions {
+		if ses.expiration < presently {
+			continue
+		}
+		if (filter.userId != "" && ses.userId != filter.userId) || (filter.ip != "" && ses.ip != filter.ip) {
+			continue
+		}
+		if filter.key != "" {
+			if _, ok := ses.liveData(now.UnixNano())[filter.key]; !ok {
+				continue
+			}
+		}
+		matched = append(matched, ah.adminSession(key, ses, false))
+	}
+	block.RUnlock()
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Handle < matched[j].Handle
+	})
+
+	page := AdminPage{Total: len(matched)}
+	start := sort.Search(len(matched), func(i int) bool {
+		return matched[i].Handle > filter.cursor
+	})
+	end := start + filter.limit
+	if end < len(matched) {
+		page.Next = matched[end-1].Handle
+	} else {
+		end = len(matched)
+	}
+	page.Sessions = matched[start:end]
+	return page
+}
+
+// The viewS(handle) AdminHandler-method safely finds the live session by its public handle
+func (ah *AdminHandler) viewS(handle string) (AdminSession, bool) {
+	presently := clockNow().Unix()
+	block.RLock()
+	defer block.RUnlock()
+	key, ok := allHandles[handle]
+	if !ok {
+		return AdminSession{}, false
+	}
+	ses, ok := allSessions[key]
+	if !ok || ses.expiration < presently {
+		return AdminSession{}, false
+	}
+	return ah.adminSession(key, ses, true), true
+}
+
+// The destroyS(handle) AdminHandler-method safely destroys the session by its public handle
+func (ah *AdminHandler) destroyS(handle string) bool {
+	block.Lock()
+	key, found := allHandles[handle]
+	if found {
+		destroyLocked(key, idOfKey(key))
+	}
+	unlockS()
+	return found
+}
+
+// The filter(r) AdminHandler-method reads the filter of the list from the query
+func (ah *AdminHandler) filter(r *http.Request) adminFilter {
+	q := r.URL.Query()
+	filter := adminFilter{
+		userId: q.Get("user"),
+		ip:     q.Get("ip"),
+		key:    q.Get("key"),
+		cursor: q.Get("cursor"),
+		limit:  ah.setings.PageSize,
+	}
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil && limit > 0 {
+		filter.limit = limit
+	}
+	if filter.limit > GOSESSION_ADMIN_MAX_PAGE_SIZE {
+		filter.limit = GOSESSION_ADMIN_MAX_PAGE_SIZE
+	}
+	return filter
+}
+
+// The writeJSON(w, status, v) function responds with the JSON value
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// The authorized(w, r, action) AdminHandler-method checks the authorization and responds 403 Forbidden if it fails
+func (ah *AdminHandler) authorized(w http.ResponseWriter, r *http.Request, action AdminAction) bool {
+	if ah.setings.Authorize != nil && ah.setings.Authorize(r, action) {
+		return true
+	}
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	return false
+}
+
+// The allowMethod(w, r, method) function responds 405 Method Not Allowed if the request has another method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || (method == http.MethodGet && r.Method == http.MethodHead) {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+// The ServeHTTP(w, r) AdminHandler-method routes the request of the admin handler
+func (ah *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		if allowMethod(w, r, http.MethodGet) && ah.authorized(w, r, GOSESSION_ADMIN_LIST) {
+			ah.listHTML(w, r)
+		}
+	case len(parts) == 2 && parts[0] == "session":
+		if allowMethod(w, r, http.MethodGet) && ah.authorized(w, r, GOSESSION_ADMIN_VIEW) {
+			ah.viewHTML(w, parts[1])
+		}
+	case len(parts) == 3 && parts[0] == "session" && parts[2] == "destroy":
+		if !allowMethod(w, r, http.MethodPost) || !ah.authorized(w, r, GOSESSION_ADMIN_DESTROY) {
+			return
+		}
+		if !checkOrigin(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		ah.destroyS(parts[1])
+		w.Header().Set("Location", "../../")
+		w.WriteHeader(http.StatusSeeOther)
+	case len(parts) == 2 && parts[0] == "api" && parts[1] == "sessions":
+		if allowMethod(w, r, http.MethodGet) && ah.authorized(w, r, GOSESSION_ADMIN_LIST) {
+			writeJSON(w, http.StatusOK, ah.listS(ah.filter(r)))
+		}
+	case len(parts) == 3 && parts[0] == "api" && parts[1] == "sessions":
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			if !ah.authorized(w, r, GOSESSION_ADMIN_VIEW) {
+				return
+			}
+			if as, ok := ah.viewS(parts[2]); ok {
+				writeJSON(w, http.StatusOK, as)
+			} else {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+			}
+		case http.MethodDelete:
+			if !ah.authorized(w, r, GOSESSION_ADMIN_DESTROY) {
+				return
+			}
+			if ah.destroyS(parts[2]) {
+				w.WriteHeader(http.StatusNoContent)
+			} else {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+			}
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// The adminFuncs variable stores the functions used in the templates of the admin handler
+var adminFuncs = template.FuncMap{
+	"time": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"text": func(v interface{}) string { return fmt.Sprintf("%v", v) },
+}
+
+// The adminListTemplate variable stores the template of the HTML list of sessions
+var adminListTemplate = template.Must(template.New("list").Funcs(adminFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Sessions</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:2px 6px;text-align:left}</style>
+</head><body>
+<h1>Sessions ({{.Page.Total}})</h1>
+<form method="get">
+User <input name="user" value="{{.Filter.userId}}"> IP <input name="ip" value="{{.Filter.ip}}"> Variable <input name="key" value="{{.Filter.key}}">
+<button>Filter</button>
+</form>
+<table>
+<tr><th>Handle</th><th>User</th><th>IP</th><th>Created</th><th>Last seen</th><th>Expiration</th><th>Size</th><th>Variables</th></tr>
+{{range .Page.Sessions}}<tr><td><a href="session/{{.Handle}}">{{.Handle}}</a></td><td>{{.UserId}}</td><td>{{.IP}}</td><td>{{time .Created}}</td><td>{{time .LastSeen}}</td><td>{{time .Expiration}}</td><td>{{.Size}}</td><td>{{len .Keys}}</td></tr>
+{{end}}</table>
+{{if .NextURL}}<p><a href="{{.NextURL}}">Next page</a></p>{{end}}
+</body></html>
+`))
+
+// The adminViewTemplate variable stores the template of the HTML view of one session
+var adminViewTemplate = template.Must(template.New("view").Funcs(adminFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Session {{.Handle}}</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:2px 6px;text-align:left;vertical-align:top}</style>
+</head><body>
+<p><a href="../">All sessions</a></p>
+<h1>Session {{.Handle}}</h1>
+<table>
+<tr><th>User</th><td>{{.UserId}}</td></tr>
+<tr><th>IP</th><td>{{.IP}}</td></tr>
+<tr><th>User-Agent</th><td>{{.UserAgent}}</td></tr>
+<tr><th>Created</th><td>{{time .Created}}</td></tr>
+<tr><th>Last seen</th><td>{{time .LastSeen}}</td></tr>
+<tr><th>Expiration</th><td>{{time .Expiration}}</td></tr>
+<tr><th>Size</th><td>{{.Size}}</td></tr>
+</table>
+<h2>Variables</h2>
+<table>
+{{range $name := .Keys}}<tr><th>{{$name}}</th><td>{{text (index $.Data $name)}}</td></tr>
+{{end}}</table>
+<form method="post" action="{{.Handle}}/destroy"><button>Destroy the session</button></form>
+</body></html>
+`))
+
+// The htmlHeaders(w) function sets the headers of the HTML view
+func htmlHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+}
+
+// The listHTML(w, r) AdminHandler-method shows the list of sessions
+func (ah *AdminHandler) listHTML(w http.ResponseWriter, r *http.Request) {
+	filter := ah.filter(r)
+	page := ah.listS(filter)
+	nextURL := ""
+	if page.Next != "" {
+		q := r.URL.Query()
+		q.Set("cursor", page.Next)
+		nextURL = "?" + q.Encode()
+	}
+	htmlHeaders(w)
+	adminListTemplate.Execute(w, struct {
+		Page    AdminPage
+		Filter  map[string]string
+		NextURL string
+	}{
+		Page:    page,
+		Filter:  map[string]string{"userId": filter.userId, "ip": filter.ip, "key": filter.key},
+		NextURL: nextURL,
+	})
+}
+
+// The viewHTML(w, handle) AdminHandler-method shows one session
+func (ah *AdminHandler) viewHTML(w http.ResponseWriter, handle string) {
+	as, ok := ah.viewS(handle)
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	htmlHeaders(w)
+	adminViewTemplate.Execute(w, as)
+}
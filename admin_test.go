@@ -0,0 +1,204 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The testAdminHandler(actions) function creates the admin handler that allows only the actions
+func testAdminHandler(actions ...AdminAction) *AdminHandler {
+	return NewAdminHandler(AdminSetings{
+		Authorize: func(r *http.Request, action AdminAction) bool {
+			for _, a := range actions {
+				if a == action {
+					return true
+				}
+			}
+			return false
+		},
+		RedactKeys: []string{"password", "token.*"},
+		PageSize:   2,
+	})
+}
+
+// The adminRequest(ah, method, target) function sends the request to the admin handler
+func adminRequest(ah *AdminHandler, method string, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ah.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_AdminSetings_redacted(t *testing.T) {
+	as := AdminSetings{RedactKeys: []string{"password", "token.*"}}
+	for name, want := range map[string]bool{"password": true, "token.access": true, "passwords": false, "cart": false} {
+		// work check
+		if as.redacted(name) != want { // calling the tested function
+			t.Errorf("Incorrect redaction of %q.", name)
+		}
+	}
+	// work check
+	if !(AdminSetings{RedactKeys: []string{"*"}}).redacted("cart") { // calling the tested function
+		t.Error("The \"*\" rule does not hide all values.")
+	}
+}
+
+func Test_AdminHandler_list(t *testing.T) {
+	ah := testAdminHandler(GOSESSION_ADMIN_LIST)
+	userId := "admin list user"
+	var w http.ResponseWriter = httptest.NewRecorder()
+	ids := make([]SessionId, 0, 3)
+	for i := 0; i < 3; i++ {
+		id := startTestSession()
+		id, _ = id.Login(&w, userId)
+		ids = append(ids, id)
+	}
+	defer DestroyUserSessions(userId)
+
+	seen := make(map[string]bool)
+	cursor := ""
+	for {
+		res := adminRequest(ah, "GET", "/api/sessions?user="+strings.ReplaceAll(userId, " ", "+")+"&cursor="+cursor) // calling the tested function
+		var page AdminPage
+		// work check
+		if err := json.NewDecoder(res.Body).Decode(&page); err != nil || res.Code != http.StatusOK {
+			t.Fatalf("Incorrect response: %v %v", res.Code, err)
+		}
+		// work check
+		if page.Total != 3 || len(page.Sessions) > 2 {
+			t.Fatalf("Incorrect page: %+v", page)
+		}
+		for _, as := range page.Sessions {
+			seen[as.Handle] = true
+		}
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+	for _, id := range ids {
+		// work check
+		if !seen[id.key().handle()] {
+			t.Error("The session is missing from the list.")
+		}
+	}
+
+	handles := []string{ids[0].key().handle(), ids[1].key().handle(), ids[2].key().handle()}
+	sort.Strings(handles)
+	res := adminRequest(ah, "GET", "/?user="+strings.ReplaceAll(userId, " ", "+")) // calling the tested function
+	body := res.Body.String()
+	// work check
+	if res.Code != http.StatusOK || !strings.Contains(body, handles[0]) || !strings.Contains(body, handles[1]) || strings.Contains(body, handles[2]) || !strings.Contains(body, "Next page") {
+		t.Error("Incorrect HTML list.")
+	}
+}
+
+func Test_AdminHandler_view(t *testing.T) {
+	ah := testAdminHandler(GOSESSION_ADMIN_VIEW)
+	id := startTestSession()
+	id.Set("cart", "item")
+	id.Set("password", "secret")
+	id.Set("token.access", "secret")
+	defer id.destroyS()
+	handle := id.key().handle()
+
+	res := adminRequest(ah, "GET", "/api/sessions/"+handle) // calling the tested function
+	var as AdminSession
+	// work check
+	if err := json.NewDecoder(res.Body).Decode(&as); err != nil || res.Code != http.StatusOK {
+		t.Fatalf("Incorrect response: %v %v", res.Code, err)
+	}
+	// work check
+	if as.Data["cart"] != "item" || as.Data["password"] != GOSESSION_ADMIN_REDACTED || as.Data["token.access"] != GOSESSION_ADMIN_REDACTED || len(as.Keys) != 3 {
+		t.Errorf("Incorrect session: %+v", as)
+	}
+
+	res = adminRequest(ah, "GET", "/session/"+handle) // calling the tested function
+	// work check
+	if res.Code != http.StatusOK || strings.Contains(res.Body.String(), "secret") || !strings.Contains(res.Body.String(), "item") {
+		t.Error("Incorrect HTML view.")
+	}
+	// work check
+	if res := adminRequest(ah, "GET", "/api/sessions/unknown"); res.Code != http.StatusNotFound { // calling the tested function
+		t.Errorf("Unknown session returned status: %v", res.Code)
+	}
+}
+
+func Test_AdminHandler_destroy(t *testing.T) {
+	ah := testAdminHandler(GOSESSION_ADMIN_DESTROY)
+	id := startTestSession()
+	res := adminRequest(ah, "DELETE", "/api/sessions/"+id.key().handle()) // calling the tested function
+	// work check
+	if res.Code != http.StatusNoContent || id.GetAll() != nil {
+		t.Errorf("The session was not destroyed: %v", res.Code)
+	}
+	block.RLock()
+	_, indexed := allHandles[id.key().handle()]
+	block.RUnlock()
+	// work check
+	if indexed {
+		t.Error("The handle of the destroyed session is still indexed.")
+	}
+
+	id = startTestSession()
+	r := httptest.NewRequest("POST", "/session/"+id.key().handle()+"/destroy", nil)
+	r.Header.Set("Origin", "http://evil.example")
+	w := httptest.NewRecorder()
+	ah.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if w.Code != http.StatusForbidden || id.GetAll() == nil {
+		t.Error("The cross-site form destroyed the session.")
+	}
+
+	r.Header.Set("Origin", "http://example.com")
+	w = httptest.NewRecorder()
+	ah.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "../../" || id.GetAll() != nil {
+		t.Errorf("The form did not destroy the session: %v", w.Code)
+	}
+}
+
+func Test_AdminHandler_authorize(t *testing.T) {
+	id := startTestSession()
+	defer id.destroyS()
+	ah := testAdminHandler(GOSESSION_ADMIN_LIST, GOSESSION_ADMIN_VIEW)
+	// work check
+	if res := adminRequest(ah, "DELETE", "/api/sessions/"+id.key().handle()); res.Code != http.StatusForbidden || id.GetAll() == nil { // calling the tested function
+		t.Error("The action was not authorized.")
+	}
+	// work check
+	if res := adminRequest(NewAdminHandler(AdminSetings{}), "GET", "/api/sessions"); res.Code != http.StatusForbidden { // calling the tested function
+		t.Error("The handler without the callback is open.")
+	}
+	// work check
+	if res := adminRequest(ah, "POST", "/api/sessions"); res.Code != http.StatusMethodNotAllowed { // calling the tested function
+		t.Errorf("Wrong method returned status: %v", res.Code)
+	}
+	// work check
+	if res := adminRequest(ah, "GET", "/unknown"); res.Code != http.StatusNotFound { // calling the tested function
+		t.Errorf("Unknown route returned status: %v", res.Code)
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_AdminHandler_listS(b *testing.B) {
+	ah := testAdminHandler()
+	for i := 0; i < b.N; i++ {
+		ah.listS(adminFilter{limit: GOSESSION_ADMIN_PAGE_SIZE}) // calling the tested function
+	}
+}
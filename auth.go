@@ -0,0 +1,284 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	GOSESSION_LOGIN_URL       string = "/login"    // Address of the login page
+	GOSESSION_REAUTH_URL      string = "/reauth"   // Address of the page for repeated authentication
+	GOSESSION_RETURN_TO_PARAM string = "return_to" // Name of the query parameter with the address to return to after login
+	GOSESSION_LEVEL_PARAM     string = "level"     // Name of the query parameter with the required authentication level
+)
+
+// The AuthLevel type is the strength of the user authentication, a greater value means a stronger authentication
+type AuthLevel int
+
+const (
+	GOSESSION_AUTH_NONE     AuthLevel = iota // The user is not authenticated
+	GOSESSION_AUTH_PASSWORD                  // The user entered the password, this level is set by Login()
+	GOSESSION_AUTH_MFA                       // The user passed the multi-factor authentication
+)
+
+// The ErrTooManySessions error is returned by Login() when the user already has the maximum number of sessions
+var ErrTooManySessions = errors.New("gosession: too many sessions of the user")
+
+// The ErrNotAuthenticated error is returned by Elevate() when the user is not logged in to the session
+var ErrNotAuthenticated = errors.New("gosession: the user is not authenticated")
+
+// The AuthSetings type describes the settings for the user authentication mechanism
+type AuthSetings struct {
+	LoginURL           string
+	ReauthURL          string
+	ReturnToParam      string
+	MaxSessionsPerUser int                    // Maximum number of simultaneous sessions of one user, 0 - no limit
+	LimitPolicy        SessionLimitPolicy     // What to do when the user exceeds the limit of sessions
+	OnEvict            func(info SessionInfo) // Called for each session deleted because of the limit
+}
+
+// Authentication settings variable
+var setingsAuth = AuthSetings{
+	LoginURL:      GOSESSION_LOGIN_URL,
+	ReauthURL:     GOSESSION_REAUTH_URL,
+	ReturnToParam: GOSESSION_RETURN_TO_PARAM,
+}
+
+// The regenerateS(w, change) method safely moves the session to a new id, applies the change to it and sends the new cookie to the client.
+// If there is no session with the old id, a new empty session is created.
+// If the change returns an error, the session stays unchanged under the old id.
+func (id SessionId) regenerateS(w *http.ResponseWriter, change func(ses *internalSession) error) (SessionId, error) {
+	newId := generateId()
+	presently := clockNow().Unix()
+	block.Lock()
+	ses, ok := fetchLocked(id.key())
+	if !ok {
+		ses.data = make(Session, 0)
+		ses.created = presently
+	}
+	if err := change(&ses); err != nil {
+		unlockS()
+		return id, err
+	}
+	dropLocked(id.key())
+	ses.expiration = presently + setingsSession.Expiration
+	putLocked(newId.key(), ses)
+	if ok {
+		emitLocked(GOSESSION_EVENT_REGENERATE, newId.key(), newId, id, ses)
+	} else {
+		emitLocked(GOSESSION_EVENT_CREATE, newId.key(), newId, "", ses)
+	}
+	unlockS()
+	setCookie(w, newId)
+	return newId, nil
+}
+
+// The Login(w, userId) SessionId-method marks the session as belonging to the authenticated user.
+// The session id and the CSRF token are changed to prevent session fixation, so the handler must continue to work with the returned id.
+// If the user has reached the limit of sessions and the policy is GOSESSION_LIMIT_REJECT, the ErrTooManySessions error is returned and the session is not changed.
+// userId - identifier of the user.
+func (id SessionId) Login(w *http.ResponseWriter, userId string) (SessionId, error) {
+	if setingsAuth.MaxSessionsPerUser > 0 {
+		indexStoredUserS(userId)
+	}
+	var evicted []SessionInfo
+	newId, err := id.regenerateS(w, func(ses *internalSession) error {
+		var err error
+		evicted, err = limitUserLocked(userId, id.key())
+		if err != nil {
+			return err
+		}
+		ses.userId = userId
+		ses.authAt = clockNow().Unix()
+		ses.authTimes = map[AuthLevel]int64{GOSESSION_AUTH_PASSWORD: ses.authAt}
+		ses.csrf = generateCSRF()
+		return nil
+	})
+	if setingsAuth.OnEvict != nil {
+		for _, info := range evicted {
+			setingsAuth.OnEvict(info)
+		}
+	}
+	return newId, err
+}
+
+// The Logout(w) SessionId-method removes the user authentication from the session, the rest of the session variables are kept.
+// The session id is changed, so the handler must continue to work with the returned id.
+func (id SessionId) Logout(w *http.ResponseWriter) SessionId {
+	newId, _ := id.regenerateS(w, func(ses *internalSession) error {
+		ses.userId = ""
+		ses.authAt = 0
+		ses.authTimes = nil
+		ses.csrf = generateCSRF()
+		return nil
+	})
+	return newId
+}
+
+// The IsAuthenticated() SessionId-method reports whether the user is logged in to the session
+func (id SessionId) IsAuthenticated() bool {
+	ses, ok := id.readS()
+	return ok && ses.userId != "" && ses.expiration >= clockNow().Unix()
+}
+
+// The UserId() SessionId-method returns the identifier of the authenticated user, or an empty string
+func (id SessionId) UserId() string {
+	ses, _ := id.readS()
+	return ses.userId
+}
+
+// The AuthenticatedAt() SessionId-method returns the time of the user login, or zero time if the user is not logged in
+func (id SessionId) AuthenticatedAt() time.Time {
+	ses, _ := id.readS()
+	if ses.authAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ses.authAt, 0)
+}
+
+// The Elevate(w, level) SessionId-method records the successful repeated authentication of the user at the given level,
+// for example after entering the password again or passing the second factor.
+// The session id is changed, so the handler must continue to work with the returned id.
+// level - strength of the passed authentication.
+func (id SessionId) Elevate(w *http.ResponseWriter, level AuthLevel) (SessionId, error) {
+	return id.regenerateS(w, func(ses *internalSession) error {
+		if ses.userId == "" {
+			return ErrNotAuthenticated
+		}
+		ses.authAt = clockNow().Unix()
+		authTimes := make(map[AuthLevel]int64, len(ses.authTimes)+1)
+		for l, t := range ses.authTimes {
+			authTimes[l] = t
+		}
+		authTimes[level] = ses.authAt
+		ses.authTimes = authTimes
+		ses.csrf = generateCSRF()
+		return nil
+	})
+}
+
+// The AuthLevel() SessionId-method returns the strongest authentication level passed in the session
+func (id SessionId) AuthLevel() AuthLevel {
+	ses, _ := id.readS()
+	res := GOSESSION_AUTH_NONE
+	for l := range ses.authTimes {
+		if l > res {
+			res = l
+		}
+	}
+	return res
+}
+
+// The IsFreshAuth(maxAge, level) SessionId-method reports whether the user passed the authentication
+// of the given level or stronger no earlier than maxAge ago.
+func (id SessionId) IsFreshAuth(maxAge time.Duration, level AuthLevel) bool {
+	ses, ok := id.readS()
+	if !ok || ses.userId == "" || ses.expiration < clockNow().Unix() {
+		return false
+	}
+	oldest := clockNow().Add(-maxAge).Unix()
+	for l, t := range ses.authTimes {
+		if l >= level && t >= oldest {
+			return true
+		}
+	}
+	return false
+}
+
+// The isSafeReturnTo(target) function checks that the address is a local path and cannot redirect the client to another site
+func isSafeReturnTo(target string) bool {
+	if target == "" || target[0] != '/' || strings.HasPrefix(target, "//") || strings.ContainsAny(target, "\\\r\n\t") {
+		return false
+	}
+	u, err := url.Parse(target)
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
+
+// The ReturnTo(r) function returns the address from the return parameter of the request, if it is safe, or "/".
+// It is used by the login handler to return the user to the page from which the RequireAuth middleware sent the user.
+func ReturnTo(r *http.Request) string {
+	target := r.FormValue(setingsAuth.ReturnToParam)
+	if !isSafeReturnTo(target) {
+		return "/"
+	}
+	return target
+}
+
+// The redirectWithReturn(w, r, target) function redirects the client to the target page, passing the current address in the return parameter
+func redirectWithReturn(w http.ResponseWriter, r *http.Request, target string) {
+	u, err := url.Parse(target)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if isSafeMethod(r.Method) && isSafeReturnTo(r.URL.RequestURI()) {
+		q := u.Query()
+		q.Set(setingsAuth.ReturnToParam, r.URL.RequestURI())
+		u.RawQuery = q.Encode()
+	}
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+// The RequireAuth(next) middleware passes the request to the next handler only if the user is logged in,
+// otherwise it redirects the client to the login page from the settings.
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := getCookieId(r)
+		if !ok || !id.IsAuthenticated() {
+			redirectWithReturn(w, r, setingsAuth.LoginURL)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The RequireFreshAuth(maxAge, level) function returns a middleware that passes the request to the next handler only if
+// the user passed the authentication of the given level or stronger no earlier than maxAge ago ("sudo mode").
+// Not logged in users are redirected to the login page, others to the page for repeated authentication with the required level.
+func RequireFreshAuth(maxAge time.Duration, level AuthLevel) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := getCookieId(r)
+			if !ok || !id.IsAuthenticated() {
+				redirectWithReturn(w, r, setingsAuth.LoginURL)
+				return
+			}
+			if !id.IsFreshAuth(maxAge, level) {
+				u, err := url.Parse(setingsAuth.ReauthURL)
+				if err != nil {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				q := u.Query()
+				q.Set(GOSESSION_LEVEL_PARAM, strconv.Itoa(int(level)))
+				u.RawQuery = q.Encode()
+				redirectWithReturn(w, r, u.String())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// The SetAuthSetings(setings) sets new settings for the user authentication mechanism.
+// setings - gosession.AuthSetings public type variable for setting new authentication settings
+func SetAuthSetings(setings AuthSetings) {
+	if setings.LoginURL == "" {
+		setings.LoginURL = GOSESSION_LOGIN_URL
+	}
+	if setings.ReauthURL == "" {
+		setings.ReauthURL = GOSESSION_REAUTH_URL
+	}
+	if setings.ReturnToParam == "" {
+		setings.ReturnToParam = GOSESSION_RETURN_TO_PARAM
+	}
+	setingsAuth = setings
+}
@@ -0,0 +1,293 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// --------------
+// Test functions
+// --------------
+
+func Test_Login(t *testing.T) {
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		var oldId SessionId
+		var newId SessionId
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			oldId = Start(&w, r)
+			oldId.Set("cart", "product")
+			newId, _ = oldId.Login(&w, "user") // calling the tested function
+			io.WriteString(w, "<html><head><title>Title</title></head><body>Body</body></html>")
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		handler(w, r)
+
+		// work check
+		if oldId == newId {
+			t.Error("The session id was not changed.")
+		}
+		// work check
+		if _, ok := oldId.readS(); ok {
+			t.Error("The old session was not deleted.")
+		}
+		// work check
+		if !newId.IsAuthenticated() || newId.UserId() != "user" || newId.Get("cart") != "product" {
+			t.Error("Incorrect authenticated session.")
+		}
+		// work check
+		if newId.AuthenticatedAt().IsZero() {
+			t.Error("The authentication time was not recorded.")
+		}
+
+		cookies := w.Result().Cookies()
+		// work check
+		if cookies[len(cookies)-1].Value != string(newId) {
+			t.Error("The client did not receive the new id.")
+		}
+	}
+}
+
+func Test_Logout(t *testing.T) {
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		w := httptest.NewRecorder()
+		var rw http.ResponseWriter = w
+		id, _ := generateId().Login(&rw, "user")
+		id.Set("cart", "product")
+
+		newId := id.Logout(&rw) // calling the tested function
+		// work check
+		if newId == id || newId.IsAuthenticated() || newId.UserId() != "" || !newId.AuthenticatedAt().IsZero() {
+			t.Error("The user was not logged out.")
+		}
+		// work check
+		if newId.Get("cart") != "product" {
+			t.Error("Session variables were lost.")
+		}
+	}
+}
+
+func Test_IsAuthenticated(t *testing.T) {
+	id := generateId()
+	allSessions[id] = internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       make(Session),
+		userId:     "user",
+	}
+	// work check
+	if !id.IsAuthenticated() { // calling the tested function
+		t.Error("The user is not authenticated.")
+	}
+
+	allSessions[id] = internalSession{
+		expiration: 0,
+		data:       make(Session),
+		userId:     "user",
+	}
+	// work check
+	if id.IsAuthenticated() { // calling the tested function
+		t.Error("The expired session is authenticated.")
+	}
+
+	// work check
+	if generateId().IsAuthenticated() { // calling the tested function
+		t.Error("The nonexistent session is authenticated.")
+	}
+}
+
+func Test_isSafeReturnTo(t *testing.T) {
+	tests := map[string]bool{
+		"":                    false,
+		"/":                   true,
+		"/cart?item=1":        true,
+		"//evil.com":          false,
+		"/\\evil.com":         false,
+		"http://evil.com":     false,
+		"evil.com":            false,
+		"/path\r\nLocation:x": false,
+	}
+	for target, result := range tests {
+		// work check
+		if isSafeReturnTo(target) != result { // calling the tested function
+			t.Errorf("Incorrect check of the address: %q", target)
+		}
+	}
+}
+
+func Test_ReturnTo(t *testing.T) {
+	r := httptest.NewRequest("GET", "/login?return_to="+url.QueryEscape("/cart"), nil)
+	// work check
+	if ReturnTo(r) != "/cart" { // calling the tested function
+		t.Error("Incorrect return address.")
+	}
+
+	r = httptest.NewRequest("GET", "/login?return_to="+url.QueryEscape("https://evil.com/"), nil)
+	// work check
+	if ReturnTo(r) != "/" { // calling the tested function
+		t.Error("An unsafe return address was accepted.")
+	}
+}
+
+func Test_RequireAuth(t *testing.T) {
+	handler := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "OK")
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/account?tab=1", nil)
+	handler.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("Handler returned status: %v", w.Code)
+	}
+	// work check
+	if location := w.Header().Get("Location"); location != setingsAuth.LoginURL+"?return_to="+url.QueryEscape("/account?tab=1") {
+		t.Errorf("Incorrect redirect: %s", location)
+	}
+
+	var rw http.ResponseWriter = httptest.NewRecorder()
+	id, _ := generateId().Login(&rw, "user")
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/account", nil)
+	r.AddCookie(&http.Cookie{Name: setingsSession.CookieName, Value: string(id)})
+	handler.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if w.Code != http.StatusOK {
+		t.Errorf("Handler returned status: %v", w.Code)
+	}
+}
+
+func Test_Elevate(t *testing.T) {
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		var w http.ResponseWriter = httptest.NewRecorder()
+		id, _ := generateId().Login(&w, "user")
+		// work check
+		if id.AuthLevel() != GOSESSION_AUTH_PASSWORD {
+			t.Error("Incorrect authentication level after login.")
+		}
+
+		newId, err := id.Elevate(&w, GOSESSION_AUTH_MFA) // calling the tested function
+		// work check
+		if err != nil || newId == id || newId.AuthLevel() != GOSESSION_AUTH_MFA {
+			t.Error("The session was not elevated.")
+		}
+	}
+
+	var w http.ResponseWriter = httptest.NewRecorder()
+	id := generateId()
+	allSessions[id] = internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       make(Session),
+	}
+	newId, err := id.Elevate(&w, GOSESSION_AUTH_MFA) // calling the tested function
+	// work check
+	if err != ErrNotAuthenticated || newId != id || id.AuthLevel() != GOSESSION_AUTH_NONE {
+		t.Error("An anonymous session was elevated.")
+	}
+}
+
+func Test_IsFreshAuth(t *testing.T) {
+	var w http.ResponseWriter = httptest.NewRecorder()
+	id, _ := generateId().Login(&w, "user")
+
+	// work check
+	if !id.IsFreshAuth(time.Minute, GOSESSION_AUTH_PASSWORD) { // calling the tested function
+		t.Error("The fresh login is not fresh.")
+	}
+	// work check
+	if id.IsFreshAuth(time.Minute, GOSESSION_AUTH_MFA) { // calling the tested function
+		t.Error("The password login satisfies the MFA level.")
+	}
+
+	presently := time.Now().Unix()
+	id.updateS(func(ses *internalSession) {
+		ses.authTimes = map[AuthLevel]int64{GOSESSION_AUTH_PASSWORD: presently - 600}
+	})
+	// work check
+	if id.IsFreshAuth(5*time.Minute, GOSESSION_AUTH_PASSWORD) { // calling the tested function
+		t.Error("The stale login is fresh.")
+	}
+
+	id, _ = id.Elevate(&w, GOSESSION_AUTH_MFA)
+	// work check
+	if !id.IsFreshAuth(5*time.Minute, GOSESSION_AUTH_PASSWORD) || !id.IsFreshAuth(5*time.Minute, GOSESSION_AUTH_MFA) { // calling the tested function
+		t.Error("The elevated session is not fresh.")
+	}
+}
+
+func Test_RequireFreshAuth(t *testing.T) {
+	handler := RequireFreshAuth(5*time.Minute, GOSESSION_AUTH_MFA)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "OK")
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/password", nil)
+	handler.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if location := w.Header().Get("Location"); w.Code != http.StatusSeeOther || location != setingsAuth.LoginURL+"?return_to=%2Fpassword" {
+		t.Errorf("Incorrect redirect of the anonymous user: %v %s", w.Code, location)
+	}
+
+	var rw http.ResponseWriter = httptest.NewRecorder()
+	id, _ := generateId().Login(&rw, "user")
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/password", nil)
+	r.AddCookie(&http.Cookie{Name: setingsSession.CookieName, Value: string(id)})
+	handler.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if location := w.Header().Get("Location"); w.Code != http.StatusSeeOther || location != setingsAuth.ReauthURL+"?level=2&return_to=%2Fpassword" {
+		t.Errorf("Incorrect redirect of the stale session: %v %s", w.Code, location)
+	}
+
+	id, _ = id.Elevate(&rw, GOSESSION_AUTH_MFA)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/password", nil)
+	r.AddCookie(&http.Cookie{Name: setingsSession.CookieName, Value: string(id)})
+	handler.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if w.Code != http.StatusOK {
+		t.Errorf("Handler returned status: %v", w.Code)
+	}
+}
+
+func Test_SetAuthSetings(t *testing.T) {
+	SetAuthSetings(AuthSetings{LoginURL: "/signin", ReturnToParam: "next"}) // calling the tested function
+	// work check
+	if setingsAuth.LoginURL != "/signin" || setingsAuth.ReturnToParam != "next" {
+		t.Error("Failed to change settings.")
+	}
+
+	SetAuthSetings(AuthSetings{}) // calling the tested function
+	// work check
+	if setingsAuth.LoginURL != GOSESSION_LOGIN_URL || setingsAuth.ReauthURL != GOSESSION_REAUTH_URL || setingsAuth.ReturnToParam != GOSESSION_RETURN_TO_PARAM {
+		t.Error("Failed to set default settings.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_Login(b *testing.B) {
+	var w http.ResponseWriter = httptest.NewRecorder()
+	id := generateId()
+	for i := 0; i < b.N; i++ {
+		id, _ = id.Login(&w, "user") // calling the tested function
+	}
+}
+
+func Benchmark_IsAuthenticated(b *testing.B) {
+	var w http.ResponseWriter = httptest.NewRecorder()
+	id, _ := generateId().Login(&w, "user")
+	for i := 0; i < b.N; i++ {
+		id.IsAuthenticated() // calling the tested function
+	}
+}
@@ -0,0 +1,434 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"errors"
+	"reflect"
+)
+
+const (
+	GOSESSION_EVICTION_SAMPLES int   = 16  // Number of sessions compared when choosing the one to evict
+	GOSESSION_SESSION_OVERHEAD int64 = 256 // Approximate memory used by an empty session, in bytes
+	GOSESSION_SIZE_DEPTH       int   = 32  // Maximum depth of the references followed when measuring a session variable
+)
+
+// The ErrSessionTooLarge error is returned by Set() when the session would exceed the size limit of one session
+var ErrSessionTooLarge = errors.New("gosession: the session is too large")
+
+// The EvictionPolicy type defines which session is evicted when the capacity of the memory is exceeded
+type EvictionPolicy int
+
+const (
+	GOSESSION_EVICT_LRU             EvictionPolicy = iota // The least recently used session is evicted
+	GOSESSION_EVICT_OLDEST                                // The oldest session is evicted
+	GOSESSION_EVICT_ANONYMOUS_FIRST                       // Anonymous sessions are evicted before authenticated ones, the least recently used first
+)
+
+// The CapacitySetings type describes the limits of the sessions kept in memory.
+// Zero limits are not checked.
+type CapacitySetings struct {
+	MaxSessions     int            // Maximum number of sessions in memory
+	MaxBytes        int64          // Maximum approximate size of all sessions in memory
+	Policy          EvictionPolicy // Which session is evicted when a limit is exceeded
+	MaxSessionBytes int64          // Maximum size of one session: the encoded size with a persistent store, the approximate size without it
+}
+
+// The CapacityStats type describes the current usage of the memory and the evictions
+type CapacityStats struct {
+	Sessions             int    // Number of sessions in memory
+	Bytes                int64  // Approximate size of all sessions in memory
+	Evictions            uint64 // Number of evicted sessions since the start
+	EvictedAuthenticated uint64 // Number of evicted sessions of logged in users
+	EvictedBytes         uint64 // Approximate size of all evicted sessions
+	MaxSessions          int    // Current limit of the number of sessions
+	MaxBytes             int64  // Current limit of the size of sessions
+}
+
+// Capacity settings variable
+var setingsCapacity = CapacitySetings{}
+
+// The counters of the memory usage, they are protected by the block
+var (
+	memoryBytes          int64
+	evictions            uint64
+	evictedAuthenticated uint64
+	evictedBytes         uint64
+)
+
+// The evictedSession type is the part of the evicted session that is needed to remove it from the indexes
+type evictedSession struct {
+	userId string
+	links  map[string]string
+}
+
+// The evictedSessions variable stores the sessions that were evicted to the persistent store but stay in the user and link indexes,
+// it is protected by the block
+var evictedSessions = make(map[SessionId]evictedSession)
+
+// The valueSize(v) function returns the approximate size of the session variable.
+// The common types are counted directly, other values are measured with reflection.
+func valueSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(len(v)) + 16
+	case []byte:
+		return int64(len(v)) + 24
+	case []string:
+		n := int64(24)
+		for _, s := range v {
+			n += int64(len(s)) + 16
+		}
+		return n
+	case Session:
+		return mapSize(v)
+	case map[string]interface{}:
+		return mapSize(v)
+	case nil:
+		return 16
+	default:
+		return reflectSize(reflect.ValueOf(v), 0, make(map[sizeVisit]struct{})) + 16
+	}
+}
+
+// The sizeVisit type is the referenced memory already counted by reflectSize()
+type sizeVisit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// The reflectSize(rv, depth, seen) function returns the approximate size of the value with everything it references.
+// Each pointer, map and slice is counted once, so shared and cyclic references do not multiply the size.
+// The references deeper than GOSESSION_SIZE_DEPTH are not followed.
+// seen - the referenced memory already counted.
+func reflectSize(rv reflect.Value, depth int, seen map[sizeVisit]struct{}) int64 {
+	if !rv.IsValid() {
+		return 0
+	}
+	t := rv.Type()
+	if depth > GOSESSION_SIZE_DEPTH {
+		return int64(t.Size())
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return int64(rv.Len()) + 16
+	case reflect.Slice:
+		if rv.IsNil() {
+			return 24
+		}
+		if rv.Len() > 0 && !firstVisit(rv, seen) {
+			return 24
+		}
+		return 24 + elementsSize(rv, depth, seen)
+	case reflect.Array:
+		return elementsSize(rv, depth, seen)
+	case reflect.Map:
+		if rv.IsNil() || !firstVisit(rv, seen) {
+			return 8
+		}
+		n := int64(48)
+		iter := rv.MapRange()
+		for iter.Next() {
+			n += reflectSize(iter.Key(), depth+1, seen) + reflectSize(iter.Value(), depth+1, seen)
+		}
+		return n
+	case reflect.Struct:
+		if isFlat(t) {
+			return int64(t.Size())
+		}
+		n := int64(0)
+		for i := 0; i < rv.NumField(); i++ {
+			n += reflectSize(rv.Field(i), depth+1, seen)
+		}
+		return n
+	case reflect.Ptr:
+		if rv.IsNil() || !firstVisit(rv, seen) {
+			return 8
+		}
+		return 8 + reflectSize(rv.Elem(), depth+1, seen)
+	case reflect.Interface:
+		if rv.IsNil() {
+			return 8
+		}
+		return 8 + reflectSize(rv.Elem(), depth+1, seen)
+	default:
+		return int64(t.Size())
+	}
+}
+
+// The firstVisit(rv, seen) function remembers the memory referenced by the pointer, the map or the slice
+// and reports whether it is visited for the first time
+func firstVisit(rv reflect.Value, seen map[sizeVisit]struct{}) bool {
+	visit := sizeVisit{ptr: rv.Pointer(), typ: rv.Type()}
+	if _, ok := seen[visit]; ok {
+		return false
+	}
+	seen[visit] = struct{}{}
+	return true
+}
+
+// The elementsSize(rv, depth, seen) function returns the approximate size of the elements of the slice or the array
+func elementsSize(rv reflect.Value, depth int, seen map[sizeVisit]struct{}) int64 {
+	if isFlat(rv.Type().Elem()) {
+		return int64(rv.Len()) * int64(rv.Type().Elem().Size())
+	}
+	n := int64(0)
+	for i := 0; i < rv.Len(); i++ {
+		n += reflectSize(rv.Index(i), depth+1, seen)
+	}
+	return n
+}
+
+// The isFlat(t) function reports whether the values of the type do not reference other memory, so their size is the size of the type
+func isFlat(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return isFlat(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !isFlat(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// The mapSize(m) function returns the approximate size of the map of variables
+func mapSize(m map[string]interface{}) int64 {
+	n := int64(48)
+	for k, v := range m {
+		n += int64(len(k)) + 16 + valueSize(v)
+	}
+	return n
+}
+
+// The approxSize(key) internalSession-method returns the approximate size of the session in memory
+func (ses internalSession) approxSize(key SessionId) int64 {
+	n := GOSESSION_SESSION_OVERHEAD + int64(len(key)+len(ses.csrf)+len(ses.userId)+len(ses.ip)+len(ses.userAgent))
+	n += mapSize(ses.data)
+	for _, f := range ses.flashes {
+		n += int64(len(f.Message)) + 24
+	}
+	n += int64(len(ses.authTimes)) * 16
+	n += int64(len(ses.deadlines)) * 24
+	for kind, value := range ses.links {
+		n += int64(len(kind)+len(value)) + 32
+	}
+	return n
+}
+
+// The encodedSize(key) internalSession-method returns the size of the session: the encoded size if there is a persistent store,
+// otherwise the approximate size in memory
+func (ses internalSession) encodedSize(key SessionId) (int64, error) {
+	if setingsSession.Store == nil {
+		return ses.approxSize(key), nil
+	}
+	b, err := encodeSession(ses)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(b)), nil
+}
+
+// The checkSize(key, ses) function checks the size of the session against the limit of one session
+func checkSize(key SessionId, ses internalSession) error {
+	if setingsCapacity.MaxSessionBytes <= 0 {
+		return nil
+	}
+	size, err := ses.encodedSize(key)
+	if err != nil {
+		return err
+	}
+	if size > setingsCapacity.MaxSessionBytes {
+		return ErrSessionTooLarge
+	}
+	return nil
+}
+
+// The overCapacityLocked() function reports whether any limit is exceeded, the block must be at least read-locked
+func overCapacityLocked() bool {
+	return (setingsCapacity.MaxSessions > 0 && len(allSessions) > setingsCapacity.MaxSessions) ||
+		(setingsCapacity.MaxBytes > 0 && memoryBytes > setingsCapacity.MaxBytes)
+}
+
+// The evictBefore(a, b, presently) function reports whether the session a must be evicted before the session b
+func evictBefore(a, b internalSession, presently int64) bool {
+	if expiredA, expiredB := a.expiration < presently, b.expiration < presently; expiredA != expiredB {
+		return expiredA
+	}
+	switch setingsCapacity.Policy {
+	case GOSESSION_EVICT_OLDEST:
+		return a.created < b.created
+	case GOSESSION_EVICT_ANONYMOUS_FIRST:
+		if anonymousA, anonymousB := a.userId == "", b.userId == ""; anonymousA != anonymousB {
+			return anonymousA
+		}
+	}
+	return a.lastSeen < b.lastSeen
+}
+
+// The victimLocked(keep) function chooses the session to evict among several random sessions, the block must be at least read-locked.
+// Like in Redis, the choice is approximate, so it does not need to keep the sessions sorted.
+// keep - store key of the session that must not be evicted.
+func victimLocked(keep SessionId) (SessionId, bool) {
+	presently := clockNow().Unix()
+	var victim SessionId
+	var victimSes internalSession
+	found := false
+	samples := 0
+	for key, ses := range allSessions {
+		if key == keep {
+			continue
+		}
+		if !found || evictBefore(ses, victimSes, presently) {
+			victim, victimSes, found = key, ses, true
+		}
+		samples++
+		if samples >= GOSESSION_EVICTION_SAMPLES {
+			break
+		}
+	}
+	return victim, found
+}
+
+// The evictLocked(key) function removes the session from memory to free the capacity, the block must be locked.
+// If there is a persistent store, the session stays there and will be loaded on the next request.
+// The evicted session stays in the user and link indexes, so that it can still be listed and destroyed.
+func evictLocked(key SessionId) {
+	ses, ok := allSessions[key]
+	if !ok {
+		return
+	}
+	evictions++
+	evictedBytes += uint64(ses.size)
+	if ses.userId != "" {
+		evictedAuthenticated++
+	}
+	if setingsSession.Store == nil {
+		destroyLocked(key, idOfKey(key))
+		return
+	}
+	evictedSessions[key] = evictedSession{userId: ses.userId, links: ses.links}
+	unindexHandleLocked(key)
+	delete(allSessions, key)
+	memoryBytes -= ses.size
+}
+
+// The evictedLocked(key) function reads the evicted session from the store without putting it in memory, the block must be locked
+func evictedLocked(key SessionId) (internalSession, bool) {
+	if _, ok := evictedSessions[key]; !ok || setingsSession.Store == nil {
+		return internalSession{}, false
+	}
+	b, err := storeLoadLocked(setingsSession.Store, string(key))
+	if err != nil {
+		return internalSession{}, false
+	}
+	ses, err := decodeSession(b)
+	if err != nil {
+		return internalSession{}, false
+	}
+	return ses, true
+}
+
+// The indexedLocked(key) function reads the session found in an index: from memory or, if it was evicted, from the store.
+// The block must be locked.
+func indexedLocked(key SessionId) (internalSession, bool) {
+	if ses, ok := getLocked(key); ok {
+		return ses, true
+	}
+	return evictedLocked(key)
+}
+
+// The indexStoredLocked(key, ses) function adds the session found only in the persistent store to the user and link indexes
+// as an evicted session, for example a session written before a restart, the block must be locked
+func indexStoredLocked(key SessionId, ses internalSession) {
+	if _, ok := allSessions[key]; ok {
+		return
+	}
+	if _, ok := evictedSessions[key]; ok {
+		return
+	}
+	evictedSessions[key] = evictedSession{userId: ses.userId, links: ses.links}
+	indexUserLocked(key, ses.userId)
+	indexLinksLocked(key, ses.links)
+}
+
+// The unindexEvictedLocked(key) function removes the evicted session from the indexes when it is deleted from the store,
+// the block must be locked
+func unindexEvictedLocked(key SessionId) {
+	e, ok := evictedSessions[key]
+	if !ok {
+		return
+	}
+	unindexUserLocked(key, e.userId)
+	unindexLinksLocked(key, e.links)
+	delete(evictedSessions, key)
+}
+
+// The cacheLocked(key, ses) function puts the session in memory, counts its size and evicts other sessions if a limit is exceeded.
+// The block must be locked.
+func cacheLocked(key SessionId, ses internalSession) {
+	ses.size = ses.approxSize(key)
+	memoryBytes += ses.size - allSessions[key].size
+	indexHandleLocked(key)
+	allSessions[key] = ses
+	delete(evictedSessions, key)
+	for overCapacityLocked() {
+		victim, ok := victimLocked(key)
+		if !ok {
+			break
+		}
+		evictLocked(victim)
+	}
+}
+
+// The Size() SessionId-method returns the current size of the session in bytes,
+// the encoded size if there is a persistent store, otherwise the approximate size in memory
+func (id SessionId) Size() int64 {
+	ses, ok := id.readS()
+	if !ok {
+		return 0
+	}
+	size, _ := ses.encodedSize(id.key())
+	return size
+}
+
+// The Capacity() function returns the current usage of the memory and the number of evictions
+func Capacity() CapacityStats {
+	block.RLock()
+	defer block.RUnlock()
+	return CapacityStats{
+		Sessions:             len(allSessions),
+		Bytes:                memoryBytes,
+		Evictions:            evictions,
+		EvictedAuthenticated: evictedAuthenticated,
+		EvictedBytes:         evictedBytes,
+		MaxSessions:          setingsCapacity.MaxSessions,
+		MaxBytes:             setingsCapacity.MaxBytes,
+	}
+}
+
+// The SetCapacitySetings(setings) sets new limits of the sessions kept in memory.
+// If the new limits are already exceeded, the extra sessions are evicted immediately.
+// setings - gosession.CapacitySetings public type variable for setting new limits
+func SetCapacitySetings(setings CapacitySetings) {
+	block.Lock()
+	defer unlockS()
+	setingsCapacity = setings
+	for overCapacityLocked() {
+		victim, ok := victimLocked("")
+		if !ok {
+			break
+		}
+		evictLocked(victim)
+	}
+}
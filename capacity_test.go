@@ -0,0 +1,276 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"container/list"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The startTestSession() function starts a new session as a handler does
+func startTestSession() SessionId {
+	var id SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = Start(&w, r)
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	return id
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_approxSize(t *testing.T) {
+	small := internalSession{data: Session{"name": "value"}}
+	large := internalSession{data: Session{"name": strings.Repeat("x", 10_000)}}
+
+	// work check
+	if small.approxSize("key") <= GOSESSION_SESSION_OVERHEAD { // calling the tested function
+		t.Error("The size of the variables was not counted.")
+	}
+	// work check
+	if large.approxSize("key")-small.approxSize("key") < 9_000 { // calling the tested function
+		t.Error("The size of the long string was not counted.")
+	}
+}
+
+func Test_evictBefore(t *testing.T) {
+	presently := time.Now().Unix()
+	anonymous := internalSession{expiration: presently + 60, created: presently - 10, lastSeen: presently}
+	user := internalSession{expiration: presently + 60, created: presently - 20, lastSeen: presently - 5, userId: "user"}
+	expired := internalSession{expiration: presently - 1, created: presently, lastSeen: presently, userId: "user"}
+	defer SetCapacitySetings(CapacitySetings{})
+
+	SetCapacitySetings(CapacitySetings{Policy: GOSESSION_EVICT_LRU})
+	// work check
+	if !evictBefore(user, anonymous, presently) || !evictBefore(expired, user, presently) { // calling the tested function
+		t.Error("Incorrect LRU order.")
+	}
+
+	SetCapacitySetings(CapacitySetings{Policy: GOSESSION_EVICT_OLDEST})
+	// work check
+	if !evictBefore(user, anonymous, presently) || !evictBefore(expired, anonymous, presently) { // calling the tested function
+		t.Error("Incorrect oldest-first order.")
+	}
+
+	SetCapacitySetings(CapacitySetings{Policy: GOSESSION_EVICT_ANONYMOUS_FIRST})
+	// work check
+	if !evictBefore(anonymous, user, presently) || !evictBefore(expired, anonymous, presently) { // calling the tested function
+		t.Error("Incorrect anonymous-first order.")
+	}
+}
+
+func Test_cacheLocked(t *testing.T) {
+	defer SetCapacitySetings(CapacitySetings{})
+	before := Capacity()
+	SetCapacitySetings(CapacitySetings{MaxSessions: before.Sessions + 5})
+
+	var last SessionId
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		last = startTestSession() // calling the tested function
+	}
+	stats := Capacity()
+	// work check
+	if stats.Sessions != before.Sessions+5 {
+		t.Errorf("The limit of sessions was exceeded: %d", stats.Sessions)
+	}
+	// work check
+	if stats.Evictions-before.Evictions != uint64(GOSESSION_TESTING_ITER-5) {
+		t.Errorf("Incorrect number of evictions: %d", stats.Evictions-before.Evictions)
+	}
+	// work check
+	if _, ok := last.readS(); !ok {
+		t.Error("The session being written was evicted.")
+	}
+}
+
+func Test_SetCapacitySetings(t *testing.T) {
+	defer SetCapacitySetings(CapacitySetings{})
+	var own int64
+	for i := 0; i < 10; i++ {
+		id := startTestSession()
+		block.RLock()
+		own += allSessions[id.key()].size
+		block.RUnlock()
+	}
+	before := Capacity()
+	limit := before.Bytes - own/2
+
+	SetCapacitySetings(CapacitySetings{MaxBytes: limit}) // calling the tested function
+	stats := Capacity()
+	// work check
+	if stats.Bytes > limit || stats.Evictions == before.Evictions || stats.EvictedBytes == before.EvictedBytes {
+		t.Errorf("The sessions over the limit were not evicted: %d bytes", stats.Bytes)
+	}
+}
+
+func Test_evictLocked_store(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+	id := startTestSession()
+
+	block.Lock()
+	evictLocked(id.key()) // calling the tested function
+	_, cached := allSessions[id.key()]
+	block.Unlock()
+	// work check
+	if cached {
+		t.Error("The session was not evicted from memory.")
+	}
+	// work check
+	if _, ok := id.readS(); !ok {
+		t.Error("The evicted session was lost from the store.")
+	}
+}
+
+func Test_valueSize(t *testing.T) {
+	type item struct {
+		Name  string
+		Price int
+	}
+	type node struct {
+		Next *node
+	}
+	cyclic := &node{}
+	cyclic.Next = cyclic
+	tests := map[string]struct {
+		value interface{}
+		min   int64
+	}{
+		"ints":    {make([]int, 1<<20), 8 << 20},
+		"structs": {make([]item, 1<<16), 24 << 16},
+		"strings": {map[int]string{1: strings.Repeat("x", 1<<20)}, 1 << 20},
+		"pointer": {&item{Name: strings.Repeat("x", 1<<16)}, 1 << 16},
+		"cyclic":  {cyclic, 8},
+	}
+	for name, tt := range tests {
+		// work check
+		if size := valueSize(tt.value); size < tt.min { // calling the tested function
+			t.Errorf("The size of %v is %v, expected at least %v.", name, size, tt.min)
+		}
+	}
+
+	type twoWay struct {
+		Prev, Next *twoWay
+		Name       string
+	}
+	first := &twoWay{Name: "first"}
+	first.Next = &twoWay{Prev: first, Name: "second"}
+	shared := strings.Repeat("x", 1<<10)
+	sharedPtr := &shared
+	lst := list.New()
+	lst.PushBack(1)
+	lst.PushBack(2)
+	small := map[string]interface{}{
+		"doubly linked": first,
+		"list":          lst,
+		"shared":        []*string{sharedPtr, sharedPtr, sharedPtr, sharedPtr},
+	}
+	for name, value := range small {
+		// work check
+		if size := valueSize(value); size > 4<<10 { // calling the tested function
+			t.Errorf("The size of %v is %v, the references were counted more than once.", name, size)
+		}
+	}
+}
+
+func Test_evictLocked_indexes(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+	userId := "evicted user"
+	var w http.ResponseWriter = httptest.NewRecorder()
+	evicted, _ := startTestSession().Login(&w, userId)
+	current, _ := startTestSession().Login(&w, userId)
+	defer DestroyUserSessions(userId)
+
+	block.Lock()
+	evictLocked(evicted.key()) // calling the tested function
+	unlockS()
+	// work check
+	if len(current.Sessions()) != 2 {
+		t.Fatal("The evicted session is missing from the sessions of the user.")
+	}
+
+	count := DestroyUserSessions(userId)
+	var id SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = Start(&w, r)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: setingsSession.CookieName, Value: string(evicted)})
+	handler(httptest.NewRecorder(), r)
+	// work check
+	if count != 2 || id.IsAuthenticated() || id.UserId() != "" {
+		t.Errorf("The evicted session survived the sign out everywhere: %v", count)
+	}
+	id.destroyS()
+}
+
+func Test_Set_quota(t *testing.T) {
+	defer SetCapacitySetings(CapacitySetings{})
+	SetCapacitySetings(CapacitySetings{MaxSessionBytes: 4096})
+	large := startTestSession()
+	// work check
+	if err := large.Set("numbers", make([]int, 1<<20)); err != ErrSessionTooLarge { // calling the tested function
+		t.Error("The large slice passed the size limit of the memory store.")
+	}
+	large.destroyS()
+	id := startTestSession()
+
+	// work check
+	if err := id.Set("name", "value"); err != nil { // calling the tested function
+		t.Errorf("The small variable was rejected: %v", err)
+	}
+	// work check
+	if err := id.Set("name", strings.Repeat("x", 10_000)); err != ErrSessionTooLarge { // calling the tested function
+		t.Error("The large variable was accepted.")
+	}
+	// work check
+	if err := id.Set("list", make([]byte, 10_000)); err != ErrSessionTooLarge { // calling the tested function
+		t.Error("The large variable was accepted.")
+	}
+	// work check
+	if id.Get("name") != "value" || id.Get("list") != nil {
+		t.Error("The rejected variable changed the session.")
+	}
+
+	// the encoded size is used with a persistent store
+	useTestStore(t, NewMemoryStore())
+	id = startTestSession()
+	// work check
+	if err := id.Set("name", strings.Repeat("x", 10_000)); err != ErrSessionTooLarge { // calling the tested function
+		t.Error("The large variable was accepted by the store.")
+	}
+}
+
+func Test_Size(t *testing.T) {
+	id := startTestSession()
+	empty := id.Size() // calling the tested function
+	id.Set("name", strings.Repeat("x", 1000))
+	// work check
+	if empty <= 0 || id.Size()-empty < 1000 { // calling the tested function
+		t.Errorf("Incorrect size of the session: %d, %d", empty, id.Size())
+	}
+	// work check
+	if SessionId("unknown").Size() != 0 { // calling the tested function
+		t.Error("The unknown session has a size.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_approxSize(b *testing.B) {
+	ses := internalSession{data: Session{"name": "value", "count": 10, "list": []string{"a", "b"}}}
+	for i := 0; i < b.N; i++ {
+		ses.approxSize("key") // calling the tested function
+	}
+}
@@ -0,0 +1,65 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"reflect"
+	"time"
+)
+
+// The Timer interface is the timer created by the Clock, *time.Timer implements it
+type Timer interface {
+	// Stop prevents the timer from firing and reports whether it was stopped before firing
+	Stop() bool
+}
+
+// The Clock interface is the source of the current time and of timers for the session system.
+// It is used wherever the expiration of sessions, variables and blocked clients is computed and to schedule the cleaner,
+// so that tests can drive expiration with a fake clock, see the pkg/clocktest package.
+// The durations of operations in metrics and traces are always measured with the system clock.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine after the duration d has elapsed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// The systemClock type is the Clock of the time package, it is used when the clock is not set in the settings
+type systemClock struct{}
+
+// The Now() systemClock-method returns time.Now()
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// The AfterFunc(d, f) systemClock-method calls time.AfterFunc()
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// The currentClock() function returns the clock from the settings or the system clock
+func currentClock() Clock {
+	if setingsSession.Clock != nil {
+		return setingsSession.Clock
+	}
+	return systemClock{}
+}
+
+// The sameClock(a, b) function reports whether the clocks are the same value.
+// The clocks of a type that cannot be compared, for example a struct with a slice, are never the same.
+func sameClock(a Clock, b Clock) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if t := reflect.TypeOf(a); t != reflect.TypeOf(b) || !t.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// The clockNow() function returns the current time of the clock from the settings
+func clockNow() time.Time {
+	return currentClock().Now()
+}
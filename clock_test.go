@@ -0,0 +1,139 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"testing"
+	"time"
+)
+
+// The stubClock type is the Clock that shows a fixed time and remembers the last scheduled timer
+type stubClock struct {
+	now   time.Time
+	delay time.Duration
+	f     func()
+}
+
+// The Now() stubClock-method returns the fixed time
+func (sc *stubClock) Now() time.Time {
+	return sc.now
+}
+
+// The AfterFunc(d, f) stubClock-method remembers the timer without starting it
+func (sc *stubClock) AfterFunc(d time.Duration, f func()) Timer {
+	sc.delay, sc.f = d, f
+	return time.NewTimer(time.Hour)
+}
+
+// The sliceClock type is the Clock that cannot be compared, it counts the scheduled timers
+type sliceClock struct {
+	scheduled *int
+	zones     []string
+}
+
+// The Now() sliceClock-method returns the system time
+func (sc sliceClock) Now() time.Time {
+	return time.Now()
+}
+
+// The AfterFunc(d, f) sliceClock-method counts the timer without starting it
+func (sc sliceClock) AfterFunc(d time.Duration, f func()) Timer {
+	*sc.scheduled++
+	return time.NewTimer(time.Hour)
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_clockNow(t *testing.T) {
+	// work check
+	if time.Since(clockNow()) > time.Second { // calling the tested function
+		t.Error("The system clock is not used by default.")
+	}
+	sc := &stubClock{now: time.Unix(1_000_000, 0)}
+	setings := setingsSession
+	setings.Clock = sc
+	SetSetings(setings)
+	t.Cleanup(func() {
+		Close()
+		setings.Clock = nil
+		SetSetings(setings)
+		Open()
+	})
+
+	// work check
+	if !clockNow().Equal(sc.now) { // calling the tested function
+		t.Error("The clock from the settings is not used.")
+	}
+	id := startTestSession()
+	info, _ := id.Info()
+	// work check
+	if info.Expiration.Unix() != sc.now.Unix()+setingsSession.Expiration {
+		t.Errorf("The expiration is not computed with the clock: %v", info.Expiration)
+	}
+	id.destroyS()
+}
+
+func Test_cleaner_clock(t *testing.T) {
+	// the clock is far in the past, the duration of the run is measured with the system time anyway
+	sc := &stubClock{now: time.Unix(1_000_000, 0)}
+	setings := setingsSession
+	setings.Clock = sc
+	SetSetings(setings) // calling the tested function
+	t.Cleanup(func() {
+		Close()
+		setings.Clock = nil
+		SetSetings(setings)
+		Open()
+	})
+	// work check
+	if sc.f == nil || sc.delay != setingsSession.TimerCleaning {
+		t.Fatal("The cleaner was not scheduled with the clock.")
+	}
+
+	start := Metrics().Cleaner
+	f := sc.f
+	sc.f = nil
+	f()
+	cleaned := Metrics().Cleaner
+	// work check
+	if cleaned.Count != start.Count+1 || sc.f == nil {
+		t.Error("The cleaner did not run and reschedule itself with the clock.")
+	}
+	// work check
+	if duration := cleaned.Sum - start.Sum; duration < 0 || duration > 10 {
+		t.Errorf("The duration of the cleaner was measured with the clock: %v s", duration)
+	}
+}
+
+func Test_sameClock(t *testing.T) {
+	sc := &stubClock{}
+	// work check
+	if !sameClock(nil, nil) || !sameClock(sc, sc) || sameClock(sc, &stubClock{}) || sameClock(sc, nil) { // calling the tested function
+		t.Error("Incorrect comparison of comparable clocks.")
+	}
+	scheduled := 0
+	lc := sliceClock{scheduled: &scheduled, zones: []string{"UTC"}}
+	// work check
+	if sameClock(lc, lc) { // calling the tested function
+		t.Error("The clocks that cannot be compared are the same.")
+	}
+
+	setings := setingsSession
+	setings.Clock = lc
+	SetSetings(setings) // calling the tested function
+	SetSetings(setings) // calling the tested function
+	t.Cleanup(func() {
+		Close()
+		setings.Clock = nil
+		SetSetings(setings)
+		Open()
+	})
+	// work check
+	if scheduled != 2 {
+		t.Errorf("The cleaner was not rescheduled with the clock: %v", scheduled)
+	}
+}
@@ -0,0 +1,407 @@
+// The gosession command inspects the sessions persisted by the gosession.FileStore offline.
+//
+// Usage:
+//
+//	gosession -dir DIR [-key HEX -key-id N] [-full] COMMAND
+//
+// Commands:
+//
+//	list        list the sessions
+//	dump ID     print one session as JSON, ID is the public handle or the store key
+//	stats       print the number of sessions, the size distribution and the expiry histogram
+//	purge       delete the expired entries
+//	verify      check the checksums of all entries and decode the sessions
+//	copy DIR    copy the live sessions to another FileStore directory preserving their expiration
+//
+// The -key and -key-id flags set the AES key of the EncryptedStore in hex, then only live sessions can be decoded.
+// The types stored in the sessions are unknown to the tool, such sessions are reported as undecodable.
+// GoSession has no snapshot file format, so the tool reads only FileStore directories, other stores can be copied
+// into a FileStore directory with gosession.CopyStore() first.
+package main
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Kwynto/gosession"
+)
+
+const (
+	SCAN_PAGE int = 1000 // Number of keys read from the store at once
+)
+
+// The errEncryptedExpired error is reported for the expired sessions of the encrypted store, which cannot be decrypted
+var errEncryptedExpired = errors.New("expired, the encrypted store returns only live sessions")
+
+// The sizeBuckets and expiryBuckets variables store the upper bounds of the histograms of the stats command
+var (
+	sizeBuckets   = []int{1 << 10, 4 << 10, 16 << 10, 64 << 10}
+	expiryBuckets = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+)
+
+// The inspector type works with the store directory
+type inspector struct {
+	files     *gosession.FileStore
+	encrypted *gosession.EncryptedStore // nil if the store is not encrypted
+	full      bool                      // show the store keys instead of the public handles
+	out       io.Writer
+	now       time.Time
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// The run(args, stdout, stderr) function executes the command and returns the exit code
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gosession", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dir := flags.String("dir", "", "directory of the FileStore")
+	key := flags.String("key", "", "AES key of the EncryptedStore in hex")
+	keyId := flags.Uint("key-id", 0, "identifier of the AES key")
+	full := flags.Bool("full", false, "show the store keys instead of the public handles")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: gosession -dir DIR [-key HEX -key-id N] [-full] list | dump ID | stats | purge | verify | copy DIR")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *dir == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+		fmt.Fprintf(stderr, "gosession: %s is not a store directory\n", *dir)
+		return 1
+	}
+	files, err := gosession.NewFileStore(*dir)
+	if err != nil {
+		fmt.Fprintln(stderr, "gosession:", err)
+		return 1
+	}
+	in := &inspector{files: files, full: *full, out: stdout, now: time.Now()}
+	if *key != "" {
+		kb, err := hex.DecodeString(*key)
+		if err != nil {
+			fmt.Fprintln(stderr, "gosession: the key must be in hex")
+			return 2
+		}
+		keyring, err := gosession.NewKeyring(uint32(*keyId), kb)
+		if err != nil {
+			fmt.Fprintln(stderr, "gosession:", err)
+			return 2
+		}
+		in.encrypted = gosession.NewEncryptedStore(files, keyring)
+	}
+
+	switch cmd := flags.Arg(0); {
+	case cmd == "list" && flags.NArg() == 1:
+		err = in.list()
+	case cmd == "dump" && flags.NArg() == 2:
+		err = in.dump(flags.Arg(1))
+	case cmd == "stats" && flags.NArg() == 1:
+		err = in.stats()
+	case cmd == "purge" && flags.NArg() == 1:
+		err = in.purge()
+	case cmd == "copy" && flags.NArg() == 2:
+		err = in.copy(flags.Arg(1))
+	case cmd == "verify" && flags.NArg() == 1:
+		var damaged int
+		damaged, err = in.verify()
+		if err == nil && damaged > 0 {
+			return 1
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "gosession:", err)
+		return 1
+	}
+	return 0
+}
+
+// The keys() inspector-method returns all keys of the store
+func (in *inspector) keys() ([]string, error) {
+	var res []string
+	cursor := ""
+	for {
+		keys, next, err := in.files.Scan(cursor, SCAN_PAGE)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, keys...)
+		if next == "" {
+			return res, nil
+		}
+		cursor = next
+	}
+}
+
+// The name(key) inspector-method returns the name of the session shown to the user
+func (in *inspector) name(key string) string {
+	if in.full {
+		return key
+	}
+	return gosession.HandleOf(key)
+}
+
+// The record(key) inspector-method reads, checks and decodes the entry
+func (in *inspector) record(key string) (gosession.FileEntry, gosession.SessionRecord, error) {
+	entry, data, err := in.files.Read(key)
+	if err != nil {
+		return entry, gosession.SessionRecord{}, err
+	}
+	if in.encrypted != nil {
+		if entry.Expiration < in.now.Unix() {
+			return entry, gosession.SessionRecord{}, errEncryptedExpired
+		}
+		if data, err = in.encrypted.Load(key); err != nil {
+			return entry, gosession.SessionRecord{}, err
+		}
+	}
+	rec, err := gosession.DecodeRecord(key, data)
+	return entry, rec, err
+}
+
+// The list() inspector-method prints the table of sessions
+func (in *inspector) list() error {
+	keys, err := in.keys()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(in.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SESSION\tUSER\tEXPIRES\tSIZE\tSTATUS")
+	for _, key := range keys {
+		entry, rec, err := in.record(key)
+		status := "ok"
+		switch {
+		case err == gosession.ErrChecksum:
+			status = "damaged"
+		case entry.Expiration < in.now.Unix():
+			status = "expired"
+		case err != nil:
+			status = "undecodable: " + err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", in.name(key), rec.UserId, time.Unix(entry.Expiration, 0).Format(time.RFC3339), entry.Size, status)
+	}
+	return tw.Flush()
+}
+
+// The jsonValue(v) function returns the value as is if it can be encoded to JSON, otherwise its text representation
+func jsonValue(v interface{}) interface{} {
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return v
+}
+
+// The dump(id) inspector-method prints the session as JSON.
+// id - public handle or store key of the session.
+func (in *inspector) dump(id string) error {
+	keys, err := in.keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key != id && gosession.HandleOf(key) != id {
+			continue
+		}
+		entry, rec, err := in.record(key)
+		if err != nil {
+			return fmt.Errorf("%s: %v", in.name(key), err)
+		}
+		data := make(map[string]interface{}, len(rec.Data))
+		for name, value := range rec.Data {
+			data[name] = jsonValue(value)
+		}
+		enc := json.NewEncoder(in.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Session    string
+			Handle     string
+			UserId     string
+			Created    time.Time
+			LastSeen   time.Time
+			Expiration time.Time
+			Expired    bool
+			IP         string
+			UserAgent  string
+			Size       int
+			Data       map[string]interface{}
+			Links      map[string]string `json:",omitempty"`
+		}{
+			Session:    in.name(key),
+			Handle:     rec.Handle,
+			UserId:     rec.UserId,
+			Created:    rec.Created,
+			LastSeen:   rec.LastSeen,
+			Expiration: rec.Expiration,
+			Expired:    entry.Expiration < in.now.Unix(),
+			IP:         rec.IP,
+			UserAgent:  rec.UserAgent,
+			Size:       entry.Size,
+			Data:       data,
+			Links:      rec.Links,
+		})
+	}
+	return fmt.Errorf("session %s not found", id)
+}
+
+// The stats() inspector-method prints the number of sessions, the size distribution and the expiry histogram
+func (in *inspector) stats() error {
+	keys, err := in.keys()
+	if err != nil {
+		return err
+	}
+	var count, damaged, expired, total, largest int
+	sizes := make([]int, len(sizeBuckets)+1)
+	expiries := make([]int, len(expiryBuckets)+1)
+	for _, key := range keys {
+		entry, _, err := in.files.Read(key)
+		if err == gosession.ErrChecksum {
+			damaged++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		count++
+		total += entry.Size
+		if entry.Size > largest {
+			largest = entry.Size
+		}
+		i := 0
+		for i < len(sizeBuckets) && entry.Size > sizeBuckets[i] {
+			i++
+		}
+		sizes[i]++
+		left := time.Unix(entry.Expiration, 0).Sub(in.now)
+		if left < 0 {
+			expired++
+			continue
+		}
+		i = 0
+		for i < len(expiryBuckets) && left >= expiryBuckets[i] {
+			i++
+		}
+		expiries[i]++
+	}
+
+	fmt.Fprintf(in.out, "sessions: %d\ndamaged:  %d\nexpired:  %d\n", count, damaged, expired)
+	average := 0
+	if count > 0 {
+		average = total / count
+	}
+	fmt.Fprintf(in.out, "size:     total %d, average %d, largest %d bytes\n", total, average, largest)
+	fmt.Fprintln(in.out, "\nsize distribution:")
+	for i, n := range sizes {
+		if i < len(sizeBuckets) {
+			fmt.Fprintf(in.out, "  <= %-8s %d\n", formatBytes(sizeBuckets[i]), n)
+		} else {
+			fmt.Fprintf(in.out, "  >  %-8s %d\n", formatBytes(sizeBuckets[i-1]), n)
+		}
+	}
+	fmt.Fprintln(in.out, "\nexpires in:")
+	fmt.Fprintf(in.out, "  expired     %d\n", expired)
+	for i, n := range expiries {
+		if i < len(expiryBuckets) {
+			fmt.Fprintf(in.out, "  <  %-8s %d\n", expiryBuckets[i], n)
+		} else {
+			fmt.Fprintf(in.out, "  >= %-8s %d\n", expiryBuckets[i-1], n)
+		}
+	}
+	return nil
+}
+
+// The formatBytes(n) function formats the size in bytes with the binary unit
+func formatBytes(n int) string {
+	if n >= 1<<10 && n%(1<<10) == 0 {
+		return fmt.Sprintf("%dKiB", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// The purge() inspector-method deletes the expired entries, damaged entries are kept for the investigation
+func (in *inspector) purge() error {
+	keys, err := in.keys()
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, key := range keys {
+		entry, _, err := in.files.Read(key)
+		if err != nil || entry.Expiration >= in.now.Unix() {
+			continue
+		}
+		if err := in.files.Delete(key); err != nil {
+			return err
+		}
+		removed++
+	}
+	fmt.Fprintf(in.out, "purged %d expired sessions\n", removed)
+	return nil
+}
+
+// The verify() inspector-method checks all entries and returns the number of damaged ones
+func (in *inspector) verify() (int, error) {
+	keys, err := in.keys()
+	if err != nil {
+		return 0, err
+	}
+	damaged, undecodable := 0, 0
+	for _, key := range keys {
+		_, _, err := in.record(key)
+		switch {
+		case err == nil || err == errEncryptedExpired:
+		case err == gosession.ErrChecksum:
+			damaged++
+			fmt.Fprintf(in.out, "%s: checksum mismatch\n", in.name(key))
+		default:
+			undecodable++
+			fmt.Fprintf(in.out, "%s: %v\n", in.name(key), err)
+		}
+	}
+	fmt.Fprintf(in.out, "checked %d entries: %d damaged, %d undecodable\n", len(keys), damaged, undecodable)
+	return damaged, nil
+}
+
+// The copy(dir) inspector-method copies the live entries to the FileStore in another directory as they are,
+// so the sessions of the encrypted store are copied without the key
+func (in *inspector) copy(dir string) error {
+	dest, err := gosession.NewFileStore(dir)
+	if err != nil {
+		return err
+	}
+	keys, err := in.keys()
+	if err != nil {
+		return err
+	}
+	copied, skipped := 0, 0
+	for _, key := range keys {
+		entry, data, err := in.files.Read(key)
+		if err != nil || entry.Expiration < in.now.Unix() {
+			skipped++
+			continue
+		}
+		if err := dest.Save(key, data, entry.Expiration); err != nil {
+			return err
+		}
+		copied++
+	}
+	fmt.Fprintf(in.out, "copied %d sessions, skipped %d expired or damaged\n", copied, skipped)
+	return nil
+}
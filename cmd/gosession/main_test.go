@@ -0,0 +1,189 @@
+package main
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kwynto/gosession"
+)
+
+// The testSetings variable stores the settings of the session mechanism for the tests
+var testSetings = gosession.GoSessionSetings{
+	CookieName:    gosession.GOSESSION_COOKIE_NAME,
+	Expiration:    gosession.GOSESSION_EXPIRATION,
+	TimerCleaning: gosession.GOSESSION_TIMER_FOR_CLEANING,
+}
+
+// The testStore(t, store) function creates the sessions in the store: a live one with variables and an expired one.
+// It returns the live session.
+func testStore(t *testing.T, store gosession.Store) gosession.SessionId {
+	setings := testSetings
+	setings.Store = store
+	gosession.SetSetings(setings)
+	defer gosession.SetSetings(testSetings)
+
+	var id gosession.SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = gosession.Start(&w, r)
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	id.Set("cart", "item")
+
+	expired := []byte("expired entry")
+	if err := store.Save("expired", expired, time.Now().Unix()-10); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// The runCommand(args) function runs the tool and returns its exit code and output
+func runCommand(args ...string) (int, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String() + stderr.String()
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_list_dump(t *testing.T) {
+	dir := t.TempDir()
+	files, _ := gosession.NewFileStore(dir)
+	id := testStore(t, files)
+	key := string(id)
+	handle := gosession.HandleOf(key)
+
+	code, out := runCommand("-dir", dir, "list") // calling the tested function
+	// work check
+	if code != 0 || !strings.Contains(out, handle) || strings.Contains(out, key) || !strings.Contains(out, "expired") {
+		t.Errorf("Incorrect list (%d):\n%s", code, out)
+	}
+
+	code, out = runCommand("-dir", dir, "-full", "list") // calling the tested function
+	// work check
+	if code != 0 || !strings.Contains(out, key) {
+		t.Errorf("The full keys are not listed:\n%s", out)
+	}
+
+	code, out = runCommand("-dir", dir, "dump", handle) // calling the tested function
+	var dump struct {
+		Handle string
+		Data   map[string]interface{}
+	}
+	// work check
+	if err := json.Unmarshal([]byte(out), &dump); code != 0 || err != nil || dump.Data["cart"] != "item" || dump.Handle != handle {
+		t.Errorf("Incorrect dump (%d): %v\n%s", code, err, out)
+	}
+	// work check
+	if code, _ := runCommand("-dir", dir, "dump", "unknown"); code != 1 { // calling the tested function
+		t.Error("An unknown session was dumped.")
+	}
+}
+
+func Test_stats_purge(t *testing.T) {
+	dir := t.TempDir()
+	files, _ := gosession.NewFileStore(dir)
+	testStore(t, files)
+
+	code, out := runCommand("-dir", dir, "stats") // calling the tested function
+	// work check
+	if code != 0 || !strings.Contains(out, "sessions: 2") || !strings.Contains(out, "expired:  1") || !strings.Contains(out, "<= 1KiB") {
+		t.Errorf("Incorrect stats (%d):\n%s", code, out)
+	}
+
+	code, out = runCommand("-dir", dir, "purge") // calling the tested function
+	// work check
+	if code != 0 || !strings.Contains(out, "purged 1 expired sessions") {
+		t.Errorf("Incorrect purge (%d):\n%s", code, out)
+	}
+	// work check
+	if _, _, err := files.Read("expired"); err != gosession.ErrNotFound {
+		t.Error("The expired entry was not purged.")
+	}
+}
+
+func Test_verify(t *testing.T) {
+	dir := t.TempDir()
+	files, _ := gosession.NewFileStore(dir)
+	testStore(t, files)
+
+	// work check
+	if code, out := runCommand("-dir", dir, "verify"); code != 0 || !strings.Contains(out, "0 damaged") { // calling the tested function
+		t.Errorf("Incorrect verification (%d):\n%s", code, out)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+gosession.GOSESSION_FILE_EXT))
+	b, _ := os.ReadFile(matches[0])
+	b[len(b)-1] ^= 0xff
+	os.WriteFile(matches[0], b, 0600)
+	// work check
+	if code, out := runCommand("-dir", dir, "verify"); code != 1 || !strings.Contains(out, "checksum mismatch") { // calling the tested function
+		t.Errorf("The damaged entry was not found (%d):\n%s", code, out)
+	}
+}
+
+func Test_encrypted(t *testing.T) {
+	dir := t.TempDir()
+	files, _ := gosession.NewFileStore(dir)
+	key := bytes.Repeat([]byte{7}, 32)
+	keyring, _ := gosession.NewKeyring(3, key)
+	id := testStore(t, gosession.NewEncryptedStore(files, keyring))
+
+	code, out := runCommand("-dir", dir, "-key", hex.EncodeToString(key), "-key-id", "3", "dump", string(id)) // calling the tested function
+	// work check
+	if code != 0 || !strings.Contains(out, `"cart": "item"`) {
+		t.Errorf("The encrypted session was not decoded (%d):\n%s", code, out)
+	}
+	// work check
+	if code, _ := runCommand("-dir", dir, "dump", string(id)); code != 1 { // calling the tested function
+		t.Error("The encrypted session was decoded without the key.")
+	}
+}
+
+func Test_copy(t *testing.T) {
+	dir := t.TempDir()
+	files, _ := gosession.NewFileStore(dir)
+	id := testStore(t, files)
+	dest := filepath.Join(t.TempDir(), "copy")
+
+	code, out := runCommand("-dir", dir, "copy", dest) // calling the tested function
+	// work check
+	if code != 0 || !strings.Contains(out, "copied 1 sessions, skipped 1") {
+		t.Errorf("Incorrect copy (%d):\n%s", code, out)
+	}
+	copied, _ := gosession.NewFileStore(dest)
+	source, _, _ := files.Read(string(id))
+	entry, _, err := copied.Read(string(id))
+	// work check
+	if err != nil || entry.Expiration != source.Expiration {
+		t.Errorf("The session was not copied with its expiration: %v", err)
+	}
+}
+
+func Test_run_usage(t *testing.T) {
+	// work check
+	if code, _ := runCommand("list"); code != 2 { // calling the tested function
+		t.Error("The command without the directory was accepted.")
+	}
+	// work check
+	if code, _ := runCommand("-dir", t.TempDir(), "unknown"); code != 2 { // calling the tested function
+		t.Error("An unknown command was accepted.")
+	}
+	// work check
+	if code, _ := runCommand("-dir", filepath.Join(os.TempDir(), "gosession-missing-dir"), "list"); code != 1 { // calling the tested function
+		t.Error("A missing directory was accepted.")
+	}
+}
@@ -0,0 +1,215 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	GOSESSION_CSRF_FIELD_NAME  string = "csrf_token"   // Name of the hidden form field with the CSRF token
+	GOSESSION_CSRF_HEADER_NAME string = "X-CSRF-Token" // Name of the request header with the CSRF token
+	GOSESSION_CSRF_TOKEN_SIZE  int    = 32             // Size of the CSRF token in bytes
+)
+
+// The CSRFSetings type describes the settings for the CSRF protection mechanism
+type CSRFSetings struct {
+	FieldName      string       // Name of the hidden form field
+	HeaderName     string       // Name of the request header
+	TrustedOrigins []string     // Additional origins (scheme://host[:port]) allowed to send unsafe requests
+	FailureHandler http.Handler // Handler called when the check fails, by default responds 403 Forbidden
+}
+
+// CSRF protection settings variable
+var setingsCSRF = CSRFSetings{
+	FieldName:  GOSESSION_CSRF_FIELD_NAME,
+	HeaderName: GOSESSION_CSRF_HEADER_NAME,
+}
+
+// The generateCSRF() generates a new raw CSRF token
+func generateCSRF() []byte {
+	b := make([]byte, GOSESSION_CSRF_TOKEN_SIZE)
+	rand.Read(b)
+	return b
+}
+
+// The xorBytes(a, b) function returns the byte-by-byte XOR of two slices of equal length
+func xorBytes(a, b []byte) []byte {
+	res := make([]byte, len(a))
+	for i := range a {
+		res[i] = a[i] ^ b[i]
+	}
+	return res
+}
+
+// The maskCSRF(token) function masks the raw token with a one-time pad, so that the token in the page changes on every request (protection against BREACH)
+func maskCSRF(token []byte) string {
+	pad := generateCSRF()
+	return base64.RawURLEncoding.EncodeToString(append(pad, xorBytes(pad, token)...))
+}
+
+// The unmaskCSRF(masked) function restores the raw token from the masked value
+func unmaskCSRF(masked string) ([]byte, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(masked)
+	if err != nil || len(b) != 2*GOSESSION_CSRF_TOKEN_SIZE {
+		return nil, false
+	}
+	return xorBytes(b[:GOSESSION_CSRF_TOKEN_SIZE], b[GOSESSION_CSRF_TOKEN_SIZE:]), true
+}
+
+// The csrfS() method safely gets the raw CSRF token of the session, creating it if necessary
+func (id SessionId) csrfS() ([]byte, bool) {
+	var token []byte
+	ok := id.updateS(func(ses *internalSession) {
+		if len(ses.csrf) != GOSESSION_CSRF_TOKEN_SIZE {
+			ses.csrf = generateCSRF()
+		}
+		token = ses.csrf
+	})
+	return token, ok
+}
+
+// The CSRFToken() SessionId-method returns the masked CSRF token of the session for use in forms and headers.
+// Each call returns a different string, but all of them are valid until the token is rotated.
+func (id SessionId) CSRFToken() string {
+	token, ok := id.csrfS()
+	if !ok {
+		return ""
+	}
+	return maskCSRF(token)
+}
+
+// The CSRFField() SessionId-method returns the hidden input with the CSRF token for html/template
+func (id SessionId) CSRFField() template.HTML {
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		template.HTMLEscapeString(setingsCSRF.FieldName), id.CSRFToken()))
+}
+
+// The VerifyCSRFToken(masked) SessionId-method checks the masked token received from the client
+func (id SessionId) VerifyCSRFToken(masked string) bool {
+	ses, ok := id.readS()
+	if !ok || len(ses.csrf) != GOSESSION_CSRF_TOKEN_SIZE {
+		return false
+	}
+	token, ok := unmaskCSRF(masked)
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare(token, ses.csrf) == 1
+}
+
+// The RotateCSRFToken() SessionId-method replaces the CSRF token of the session, all previously issued tokens become invalid.
+// It is recommended to call it after the user logs in.
+func (id SessionId) RotateCSRFToken() {
+	id.updateS(func(ses *internalSession) {
+		ses.csrf = generateCSRF()
+	})
+}
+
+// The isSafeMethod(method) function reports whether the http method does not change the state of the server
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// The requestOrigin(r) function returns the origin (scheme://host) of the server to which the request came
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + strings.ToLower(r.Host)
+}
+
+// The isTrustedOrigin(origin, r) function checks the origin against the server origin and the trusted origins from the settings
+func isTrustedOrigin(origin string, r *http.Request) bool {
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	if origin == requestOrigin(r) {
+		return true
+	}
+	for _, v := range setingsCSRF.TrustedOrigins {
+		if origin == strings.ToLower(strings.TrimSuffix(v, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// The checkOrigin(r) function checks the Origin and Referer headers of the unsafe request.
+// If the Origin header is missing, the Referer is checked, it is mandatory only for https requests.
+func checkOrigin(r *http.Request) bool {
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "null" {
+		return isTrustedOrigin(origin, r)
+	}
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		return r.TLS == nil
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	return isTrustedOrigin(u.Scheme+"://"+u.Host, r)
+}
+
+// The csrfFromRequest(r) function gets the masked token from the request header or from the form field
+func csrfFromRequest(r *http.Request) string {
+	if token := r.Header.Get(setingsCSRF.HeaderName); token != "" {
+		return token
+	}
+	return r.FormValue(setingsCSRF.FieldName)
+}
+
+// The csrfFailure(w, r) function responds to the request that failed the CSRF check
+func csrfFailure(w http.ResponseWriter, r *http.Request) {
+	if setingsCSRF.FailureHandler != nil {
+		setingsCSRF.FailureHandler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+// The CSRFProtect(next) middleware checks the origin and the CSRF token of every unsafe request (POST, PUT, PATCH, DELETE, etc.)
+// before passing it to the next handler. Safe requests are passed without checking.
+func CSRFProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !checkOrigin(r) {
+			csrfFailure(w, r)
+			return
+		}
+		id, ok := getCookieId(r)
+		if !ok || !id.VerifyCSRFToken(csrfFromRequest(r)) {
+			csrfFailure(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The SetCSRFSetings(setings) sets new settings for the CSRF protection mechanism.
+// setings - gosession.CSRFSetings public type variable for setting new CSRF settings
+func SetCSRFSetings(setings CSRFSetings) {
+	if setings.FieldName == "" {
+		setings.FieldName = GOSESSION_CSRF_FIELD_NAME
+	}
+	if setings.HeaderName == "" {
+		setings.HeaderName = GOSESSION_CSRF_HEADER_NAME
+	}
+	setingsCSRF = setings
+}
@@ -0,0 +1,249 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// --------------
+// Test functions
+// --------------
+
+func Test_maskCSRF(t *testing.T) {
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		token := generateCSRF()
+		masked1 := maskCSRF(token) // calling the tested function
+		masked2 := maskCSRF(token) // calling the tested function
+		// work check
+		if masked1 == masked2 {
+			t.Error("The masked tokens are equal.")
+		}
+		res1, ok1 := unmaskCSRF(masked1)
+		res2, ok2 := unmaskCSRF(masked2)
+		// work check
+		if !ok1 || !ok2 || string(res1) != string(token) || string(res2) != string(token) {
+			t.Error("The unmasked token does not match the original token.")
+		}
+	}
+
+	// work check
+	if _, ok := unmaskCSRF("bad token"); ok {
+		t.Error("An invalid token was unmasked.")
+	}
+}
+
+func Test_CSRFToken(t *testing.T) {
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		id := generateId()
+		allSessions[id] = internalSession{
+			expiration: time.Now().Unix() + setingsSession.Expiration,
+			data:       make(Session),
+		}
+
+		token := id.CSRFToken() // calling the tested function
+		// work check
+		if !id.VerifyCSRFToken(token) {
+			t.Error("The session did not accept its own token.")
+		}
+		// work check
+		if generateId().VerifyCSRFToken(token) {
+			t.Error("The token was accepted by another session.")
+		}
+
+		id.RotateCSRFToken() // calling the tested function
+		// work check
+		if id.VerifyCSRFToken(token) {
+			t.Error("The token was accepted after rotation.")
+		}
+	}
+
+	// work check
+	if generateId().CSRFToken() != "" {
+		t.Error("A token was issued for a nonexistent session.")
+	}
+}
+
+func Test_CSRFField(t *testing.T) {
+	id := generateId()
+	allSessions[id] = internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       make(Session),
+	}
+
+	field := string(id.CSRFField()) // calling the tested function
+	// work check
+	if !strings.Contains(field, `type="hidden"`) || !strings.Contains(field, `name="`+setingsCSRF.FieldName+`"`) {
+		t.Errorf("Invalid hidden field: %s", field)
+	}
+	start := strings.Index(field, `value="`) + len(`value="`)
+	token := field[start : start+strings.Index(field[start:], `"`)]
+	// work check
+	if !id.VerifyCSRFToken(token) {
+		t.Error("The token from the hidden field was not accepted.")
+	}
+}
+
+func Test_checkOrigin(t *testing.T) {
+	SetCSRFSetings(CSRFSetings{TrustedOrigins: []string{"https://trusted.example.com"}})
+	defer SetCSRFSetings(CSRFSetings{})
+
+	tests := []struct {
+		origin  string
+		referer string
+		secure  bool
+		result  bool
+	}{
+		{"", "", false, true},
+		{"", "", true, false},
+		{"http://example.com", "", false, true},
+		{"http://evil.com", "", false, false},
+		{"https://trusted.example.com", "", false, true},
+		{"", "https://example.com/page", true, true},
+		{"", "https://evil.com/page", true, false},
+		{"", "https://trusted.example.com/page", true, true},
+	}
+
+	for _, v := range tests {
+		r := httptest.NewRequest("POST", "http://example.com/", nil)
+		if v.origin != "" {
+			r.Header.Set("Origin", v.origin)
+		}
+		if v.referer != "" {
+			r.Header.Set("Referer", v.referer)
+		}
+		if v.secure {
+			r.TLS = &tls.ConnectionState{}
+		} else {
+			r.TLS = nil
+		}
+		// work check
+		if checkOrigin(r) != v.result { // calling the tested function
+			t.Errorf("Invalid result of the origin check: %+v", v)
+		}
+	}
+}
+
+func Test_CSRFProtect(t *testing.T) {
+	handler := CSRFProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "OK")
+	}))
+
+	id := generateId()
+	allSessions[id] = internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       make(Session),
+	}
+	cookie := &http.Cookie{
+		Name:   setingsSession.CookieName,
+		Value:  string(id),
+		MaxAge: 0,
+	}
+
+	// safe method
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if w.Code != http.StatusOK {
+		t.Errorf("Handler returned status: %v", w.Code)
+	}
+
+	// without token
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/", nil)
+	r.AddCookie(cookie)
+	handler.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Handler returned status: %v", w.Code)
+	}
+
+	// token in the form field
+	form := url.Values{}
+	form.Set(setingsCSRF.FieldName, id.CSRFToken())
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(cookie)
+	handler.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if w.Code != http.StatusOK {
+		t.Errorf("Handler returned status: %v", w.Code)
+	}
+
+	// token in the header
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("DELETE", "/", nil)
+	r.Header.Set(setingsCSRF.HeaderName, id.CSRFToken())
+	r.AddCookie(cookie)
+	handler.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if w.Code != http.StatusOK {
+		t.Errorf("Handler returned status: %v", w.Code)
+	}
+
+	// foreign origin
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/", nil)
+	r.Header.Set(setingsCSRF.HeaderName, id.CSRFToken())
+	r.Header.Set("Origin", "http://evil.com")
+	r.AddCookie(cookie)
+	handler.ServeHTTP(w, r) // calling the tested function
+	// work check
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Handler returned status: %v", w.Code)
+	}
+}
+
+func Test_SetCSRFSetings(t *testing.T) {
+	SetCSRFSetings(CSRFSetings{FieldName: "test_field", HeaderName: "X-Test"}) // calling the tested function
+	// work check
+	if setingsCSRF.FieldName != "test_field" || setingsCSRF.HeaderName != "X-Test" {
+		t.Error("Failed to change settings.")
+	}
+
+	SetCSRFSetings(CSRFSetings{}) // calling the tested function
+	// work check
+	if setingsCSRF.FieldName != GOSESSION_CSRF_FIELD_NAME || setingsCSRF.HeaderName != GOSESSION_CSRF_HEADER_NAME {
+		t.Error("Failed to set default settings.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_CSRFToken(b *testing.B) {
+	id := generateId()
+	allSessions[id] = internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       make(Session),
+	}
+
+	for i := 0; i < b.N; i++ {
+		id.CSRFToken() // calling the tested function
+	}
+}
+
+func Benchmark_VerifyCSRFToken(b *testing.B) {
+	id := generateId()
+	allSessions[id] = internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       make(Session),
+	}
+	token := id.CSRFToken()
+
+	for i := 0; i < b.N; i++ {
+		id.VerifyCSRFToken(token) // calling the tested function
+	}
+}
@@ -0,0 +1,260 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+const (
+	GOSESSION_ENCRYPTION_VERSION byte = 1 // Version of the ciphertext format
+)
+
+// The errors returned by the EncryptedStore and the Keyring
+var (
+	ErrInvalidKey        = errors.New("gosession: the encryption key must be 16, 24 or 32 bytes long")
+	ErrUnknownKey        = errors.New("gosession: the session is encrypted with an unknown key")
+	ErrInvalidCiphertext = errors.New("gosession: the encrypted session is damaged")
+)
+
+// The Keyring type stores the encryption keys by their identifiers.
+// New sessions are encrypted with the primary key, the others are used only to decrypt old sessions.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[uint32]cipher.AEAD
+	primary uint32
+}
+
+// The NewKeyring(id, key) function creates a keyring with one primary AES key.
+// id - identifier of the key, it is written into the header of the ciphertext.
+// key - AES key of 16, 24 or 32 bytes.
+func NewKeyring(id uint32, key []byte) (*Keyring, error) {
+	kr := &Keyring{keys: make(map[uint32]cipher.AEAD)}
+	if err := kr.Add(id, key, true); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// The Add(id, key, primary) Keyring-method adds the key to the keyring and makes it primary if necessary
+func (kr *Keyring) Add(id uint32, key []byte, primary bool) error {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return ErrInvalidKey
+	}
+	aead, err := cipher.NewGCM(c)
+	if err != nil {
+		return err
+	}
+	kr.mu.Lock()
+	kr.keys[id] = aead
+	if primary {
+		kr.primary = id
+	}
+	kr.mu.Unlock()
+	return nil
+}
+
+// The Remove(id) Keyring-method removes the key from the keyring, the primary key cannot be removed
+func (kr *Keyring) Remove(id uint32) {
+	kr.mu.Lock()
+	if id != kr.primary {
+		delete(kr.keys, id)
+	}
+	kr.mu.Unlock()
+}
+
+// The Primary() Keyring-method returns the identifier of the primary key
+func (kr *Keyring) Primary() uint32 {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.primary
+}
+
+// The get(id) Keyring-method returns the cipher of the key
+func (kr *Keyring) get(id uint32) (cipher.AEAD, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	aead, ok := kr.keys[id]
+	return aead, ok
+}
+
+// The EncryptedStore type is a Store wrapper that encrypts sessions with AES-GCM before they reach the backing store.
+// The ciphertext contains the format version and the key identifier, and it is bound to the session key,
+// so an encrypted session cannot be moved under another key.
+type EncryptedStore struct {
+	store   Store
+	keyring *Keyring
+	mu      sync.Mutex     // Serializes writes with the re-encryption, so that it does not overwrite newer data
+	wg      sync.WaitGroup // Running background re-encryptions
+}
+
+// The NewEncryptedStore(store, keyring) function wraps the store with encryption.
+// store - backing store for encrypted sessions.
+// keyring - encryption keys.
+func NewEncryptedStore(store Store, keyring *Keyring) *EncryptedStore {
+	return &EncryptedStore{store: store, keyring: keyring}
+}
+
+// The cipherHeader(keyId) function returns the header of the ciphertext: version and key identifier
+func cipherHeader(keyId uint32) []byte {
+	h := make([]byte, 5)
+	h[0] = GOSESSION_ENCRYPTION_VERSION
+	binary.BigEndian.PutUint32(h[1:], keyId)
+	return h
+}
+
+// The encrypt(key, data) EncryptedStore-method encrypts the session with the primary key.
+// The result is: version (1 byte), key id (4 bytes), nonce, ciphertext with the tag.
+func (es *EncryptedStore) encrypt(key string, data []byte) ([]byte, error) {
+	keyId := es.keyring.Primary()
+	aead, ok := es.keyring.get(keyId)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	res := cipherHeader(keyId)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	res = append(res, nonce...)
+	return aead.Seal(res, nonce, data, append(res[:5:5], key...)), nil
+}
+
+// The decrypt(key, data) EncryptedStore-method decrypts the session and returns the identifier of the key it was encrypted with
+func (es *EncryptedStore) decrypt(key string, data []byte) ([]byte, uint32, error) {
+	if len(data) < 5 || data[0] != GOSESSION_ENCRYPTION_VERSION {
+		return nil, 0, ErrInvalidCiphertext
+	}
+	keyId := binary.BigEndian.Uint32(data[1:5])
+	aead, ok := es.keyring.get(keyId)
+	if !ok {
+		return nil, keyId, ErrUnknownKey
+	}
+	if len(data) < 5+aead.NonceSize()+aead.Overhead() {
+		return nil, keyId, ErrInvalidCiphertext
+	}
+	nonce := data[5 : 5+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, data[5+aead.NonceSize():], append(cipherHeader(keyId), key...))
+	if err != nil {
+		return nil, keyId, ErrInvalidCiphertext
+	}
+	return plain, keyId, nil
+}
+
+// The Load(key) EncryptedStore-method loads and decrypts the session
+func (es *EncryptedStore) Load(key string) ([]byte, error) {
+	data, err := es.store.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, _, err := es.decrypt(key, data)
+	return plain, err
+}
+
+// The Save(key, data, expiration) EncryptedStore-method encrypts and saves the session.
+// The session is encrypted under the lock, so the primary key cannot change between the encryption and the write
+// and a running re-encryption never misses the entry.
+func (es *EncryptedStore) Save(key string, data []byte, expiration int64) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	enc, err := es.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+	return es.store.Save(key, enc, expiration)
+}
+
+// The Delete(key) EncryptedStore-method deletes the session
+func (es *EncryptedStore) Delete(key string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.store.Delete(key)
+}
+
+// The Scan(cursor, limit) EncryptedStore-method lists the keys of the backing store
+func (es *EncryptedStore) Scan(cursor string, limit int) ([]string, string, error) {
+	return es.store.Scan(cursor, limit)
+}
+
+// The reencryptOne(key) EncryptedStore-method re-encrypts one session with the primary key if it is encrypted with another key
+func (es *EncryptedStore) reencryptOne(key string) (bool, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	data, err := es.store.Load(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	plain, keyId, err := es.decrypt(key, data)
+	if err != nil {
+		return false, err
+	}
+	if keyId == es.keyring.Primary() {
+		return false, nil
+	}
+	ses, err := decodeSession(plain)
+	if err != nil {
+		return false, err
+	}
+	enc, err := es.encrypt(key, plain)
+	if err != nil {
+		return false, err
+	}
+	return true, es.store.Save(key, enc, ses.expiration)
+}
+
+// The Reencrypt() EncryptedStore-method re-encrypts all sessions that are not encrypted with the primary key
+// and returns their number. Sessions that cannot be decrypted are skipped, the first error is returned.
+func (es *EncryptedStore) Reencrypt() (int, error) {
+	var firstErr error
+	count := 0
+	cursor := ""
+	for {
+		keys, next, err := es.store.Scan(cursor, GOSESSION_SCAN_PAGE)
+		if err != nil {
+			return count, err
+		}
+		for _, key := range keys {
+			done, err := es.reencryptOne(key)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if done {
+				count++
+			}
+		}
+		if next == "" {
+			return count, firstErr
+		}
+		cursor = next
+	}
+}
+
+// The Rotate(id, key) EncryptedStore-method adds a new primary key and starts re-encryption of all sessions in the background.
+// The old keys stay in the keyring, they can be removed after Wait() returns.
+func (es *EncryptedStore) Rotate(id uint32, key []byte) error {
+	if err := es.keyring.Add(id, key, true); err != nil {
+		return err
+	}
+	es.wg.Add(1)
+	go func() {
+		defer es.wg.Done()
+		es.Reencrypt()
+	}()
+	return nil
+}
+
+// The Wait() EncryptedStore-method waits for the background re-encryption to finish
+func (es *EncryptedStore) Wait() {
+	es.wg.Wait()
+}
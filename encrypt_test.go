@@ -0,0 +1,205 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// The testKey(b) function returns a 32-byte test key filled with one byte
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_NewKeyring(t *testing.T) {
+	// work check
+	if _, err := NewKeyring(1, []byte("short")); err != ErrInvalidKey { // calling the tested function
+		t.Error("An invalid key was accepted.")
+	}
+
+	kr, err := NewKeyring(1, testKey(1)) // calling the tested function
+	// work check
+	if err != nil || kr.Primary() != 1 {
+		t.Fatal("Failed to create the keyring.")
+	}
+
+	kr.Add(2, testKey(2), false)
+	// work check
+	if kr.Primary() != 1 {
+		t.Error("The primary key was changed.")
+	}
+	kr.Add(3, testKey(3), true)
+	kr.Remove(3)
+	kr.Remove(2)
+	// work check
+	if _, ok := kr.get(2); ok || kr.Primary() != 3 {
+		t.Error("Incorrect removing of keys.")
+	}
+	// work check
+	if _, ok := kr.get(3); !ok {
+		t.Error("The primary key was removed.")
+	}
+}
+
+func Test_EncryptedStore(t *testing.T) {
+	kr, _ := NewKeyring(1, testKey(1))
+	ms := NewMemoryStore()
+	es := NewEncryptedStore(ms, kr)
+	plain := []byte("secret session data")
+
+	es.Save("key1", plain, time.Now().Unix()+60) // calling the tested function
+	raw, _ := ms.Load("key1")
+	// work check
+	if bytes.Contains(raw, plain) || raw[0] != GOSESSION_ENCRYPTION_VERSION {
+		t.Error("The session was not encrypted.")
+	}
+
+	res, err := es.Load("key1") // calling the tested function
+	// work check
+	if err != nil || !bytes.Equal(res, plain) {
+		t.Error("Failed to decrypt the session.")
+	}
+
+	// the ciphertext is bound to its key
+	ms.Save("key2", raw, time.Now().Unix()+60)
+	// work check
+	if _, err := es.Load("key2"); err != ErrInvalidCiphertext { // calling the tested function
+		t.Error("The session was decrypted under another key.")
+	}
+
+	// damaged ciphertext
+	raw[len(raw)-1] ^= 0xff
+	ms.Save("key1", raw, time.Now().Unix()+60)
+	// work check
+	if _, err := es.Load("key1"); err != ErrInvalidCiphertext { // calling the tested function
+		t.Error("The damaged session was decrypted.")
+	}
+
+	// unknown key
+	other, _ := NewKeyring(9, testKey(9))
+	NewEncryptedStore(ms, other).Save("key3", plain, time.Now().Unix()+60)
+	// work check
+	if _, err := es.Load("key3"); err != ErrUnknownKey { // calling the tested function
+		t.Error("The session encrypted with an unknown key was decrypted.")
+	}
+}
+
+func Test_Rotate(t *testing.T) {
+	kr, _ := NewKeyring(1, testKey(1))
+	ms := NewMemoryStore()
+	es := NewEncryptedStore(ms, kr)
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		b, _ := encodeSession(internalSession{
+			expiration: time.Now().Unix() + 60,
+			data:       Session{"number": i},
+		})
+		es.Save(fmt.Sprintf("key%d", i), b, time.Now().Unix()+60)
+	}
+
+	err := es.Rotate(2, testKey(2)) // calling the tested function
+	es.Wait()
+	// work check
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kr.Remove(1)
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		raw, _ := ms.Load(fmt.Sprintf("key%d", i))
+		b, err := es.Load(fmt.Sprintf("key%d", i))
+		// work check
+		if err != nil || raw[4] != 2 {
+			t.Fatal("The session was not re-encrypted with the new key.")
+		}
+		ses, _ := decodeSession(b)
+		// work check
+		if ses.data["number"] != i {
+			t.Error("The re-encrypted session is damaged.")
+		}
+	}
+
+	count, err := es.Reencrypt() // calling the tested function
+	// work check
+	if err != nil || count != 0 {
+		t.Error("Sessions were re-encrypted twice.")
+	}
+}
+
+func Test_Rotate_concurrentSave(t *testing.T) {
+	kr, _ := NewKeyring(1, testKey(1))
+	ms := NewMemoryStore()
+	es := NewEncryptedStore(ms, kr)
+	expiration := time.Now().Unix() + 60
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		es.Save(fmt.Sprintf("key%d", i), []byte("old"), expiration)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+			es.Save(fmt.Sprintf("key%d", i), []byte("new"), expiration) // calling the tested function
+		}
+	}()
+	es.Rotate(2, testKey(2)) // calling the tested function
+	<-done
+	es.Wait()
+
+	kr.Remove(1)
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		// work check
+		if _, err := es.Load(fmt.Sprintf("key%d", i)); err != nil {
+			t.Fatalf("The session saved during the rotation is unreadable without the old key: %v", err)
+		}
+	}
+}
+
+func Test_EncryptedStore_settings(t *testing.T) {
+	kr, _ := NewKeyring(1, testKey(1))
+	ms := NewMemoryStore()
+	useTestStore(t, NewEncryptedStore(ms, kr))
+
+	var id SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = Start(&w, r)
+		id.Set("address", "secret address")
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	raw, _ := ms.Load(string(id.key()))
+	// work check
+	if bytes.Contains(raw, []byte("secret address")) {
+		t.Error("The session was stored unencrypted.")
+	}
+
+	restartMemory([]SessionId{id})
+	// work check
+	if id.Get("address") != "secret address" {
+		t.Error("The session was not loaded from the encrypted store.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_EncryptedStore(b *testing.B) {
+	kr, _ := NewKeyring(1, testKey(1))
+	es := NewEncryptedStore(NewMemoryStore(), kr)
+	data := bytes.Repeat([]byte("x"), 1024)
+	for i := 0; i < b.N; i++ {
+		es.Save("key", data, time.Now().Unix()+60) // calling the tested function
+		es.Load("key")                             // calling the tested function
+	}
+}
@@ -0,0 +1,149 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	GOSESSION_FILE_EXT         string = ".session" // Extension of the entry files of the FileStore
+	GOSESSION_FILE_MAGIC       string = "GSS1"     // Signature and version of the entry file format
+	GOSESSION_FILE_HEADER_SIZE int    = 16         // Signature, expiration and CRC-32 checksum of the data
+)
+
+// The ErrChecksum error is returned by the FileStore when the entry file is damaged
+var ErrChecksum = errors.New("gosession: the stored entry is damaged, checksum mismatch")
+
+// The FileStore type is the Store that keeps each serialized session in its own file of the directory.
+// The file has a header with the expiration and the CRC-32 checksum of the data, the files are replaced atomically.
+type FileStore struct {
+	dir string
+}
+
+// The FileEntry type describes the entry file of the FileStore
+type FileEntry struct {
+	Key        string
+	Expiration int64 // Unix time after which the entry may be deleted
+	Size       int   // Size of the data without the header
+}
+
+// The NewFileStore(dir) function opens the FileStore in the directory, creating it if necessary
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// The path(key) FileStore-method returns the name of the entry file, the key is hex-encoded so any key is a valid file name
+func (fs *FileStore) path(key string) string {
+	return filepath.Join(fs.dir, hex.EncodeToString([]byte(key))+GOSESSION_FILE_EXT)
+}
+
+// The Read(key) FileStore-method reads the entry and checks its checksum, expired entries are returned too
+func (fs *FileStore) Read(key string) (FileEntry, []byte, error) {
+	b, err := os.ReadFile(fs.path(key))
+	if os.IsNotExist(err) {
+		return FileEntry{}, nil, ErrNotFound
+	}
+	if err != nil {
+		return FileEntry{}, nil, err
+	}
+	if len(b) < GOSESSION_FILE_HEADER_SIZE || string(b[:4]) != GOSESSION_FILE_MAGIC {
+		return FileEntry{Key: key}, nil, ErrChecksum
+	}
+	entry := FileEntry{
+		Key:        key,
+		Expiration: int64(binary.BigEndian.Uint64(b[4:12])),
+		Size:       len(b) - GOSESSION_FILE_HEADER_SIZE,
+	}
+	data := b[GOSESSION_FILE_HEADER_SIZE:]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(b[12:16]) {
+		return entry, nil, ErrChecksum
+	}
+	return entry, data, nil
+}
+
+// The Load(key) FileStore-method returns the serialized session or ErrNotFound
+func (fs *FileStore) Load(key string) ([]byte, error) {
+	entry, data, err := fs.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Expiration < clockNow().Unix() {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// The Save(key, data, expiration) FileStore-method writes the serialized session to a temporary file and renames it
+func (fs *FileStore) Save(key string, data []byte, expiration int64) error {
+	b := make([]byte, GOSESSION_FILE_HEADER_SIZE, GOSESSION_FILE_HEADER_SIZE+len(data))
+	copy(b, GOSESSION_FILE_MAGIC)
+	binary.BigEndian.PutUint64(b[4:12], uint64(expiration))
+	binary.BigEndian.PutUint32(b[12:16], crc32.ChecksumIEEE(data))
+	b = append(b, data...)
+
+	tmp, err := os.CreateTemp(fs.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fs.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// The Delete(key) FileStore-method removes the entry file
+func (fs *FileStore) Delete(key string) error {
+	err := os.Remove(fs.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// The Scan(cursor, limit) FileStore-method returns the keys in sorted order starting after the cursor
+func (fs *FileStore) Scan(cursor string, limit int) ([]string, string, error) {
+	files, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, "", err
+	}
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, GOSESSION_FILE_EXT) {
+			continue
+		}
+		key, err := hex.DecodeString(strings.TrimSuffix(name, GOSESSION_FILE_EXT))
+		if err != nil || string(key) <= cursor {
+			continue
+		}
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+	if limit <= 0 || len(keys) <= limit {
+		return keys, "", nil
+	}
+	return keys[:limit], keys[limit-1], nil
+}
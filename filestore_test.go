@@ -0,0 +1,123 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// --------------
+// Test functions
+// --------------
+
+func Test_FileStore(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir()) // calling the tested function
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Unix() + 60
+
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		fs.Save(fmt.Sprintf("key/%03d", i), []byte(fmt.Sprintf("data%d", i)), future) // calling the tested function
+	}
+	b, err := fs.Load("key/007") // calling the tested function
+	// work check
+	if err != nil || string(b) != "data7" {
+		t.Errorf("Incorrect data: %q %v", b, err)
+	}
+	// work check
+	if _, err := fs.Load("missing"); err != ErrNotFound { // calling the tested function
+		t.Error("A missing entry was loaded.")
+	}
+
+	fs.Save("expired", []byte("old"), time.Now().Unix()-1)
+	// work check
+	if _, err := fs.Load("expired"); err != ErrNotFound { // calling the tested function
+		t.Error("An expired entry was loaded.")
+	}
+	entry, b, err := fs.Read("expired") // calling the tested function
+	// work check
+	if err != nil || string(b) != "old" || entry.Size != 3 {
+		t.Errorf("The expired entry was not read: %+v %v", entry, err)
+	}
+
+	count := 0
+	cursor := ""
+	for {
+		keys, next, err := fs.Scan(cursor, 10) // calling the tested function
+		if err != nil {
+			t.Fatal(err)
+		}
+		count += len(keys)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	// work check
+	if count != GOSESSION_TESTING_ITER+1 {
+		t.Errorf("Scan returned %v keys.", count)
+	}
+
+	fs.Delete("expired") // calling the tested function
+	// work check
+	if _, _, err := fs.Read("expired"); err != ErrNotFound || fs.Delete("expired") != nil {
+		t.Error("The entry was not deleted.")
+	}
+}
+
+func Test_FileStore_checksum(t *testing.T) {
+	fs, _ := NewFileStore(t.TempDir())
+	fs.Save("key", []byte("session data"), time.Now().Unix()+60)
+	b, _ := os.ReadFile(fs.path("key"))
+	b[len(b)-1] ^= 0xff
+	os.WriteFile(fs.path("key"), b, 0600)
+	// work check
+	if _, err := fs.Load("key"); err != ErrChecksum { // calling the tested function
+		t.Errorf("The damaged entry was loaded: %v", err)
+	}
+
+	os.WriteFile(fs.path("short"), []byte("GSS"), 0600)
+	// work check
+	if _, _, err := fs.Read("short"); err != ErrChecksum { // calling the tested function
+		t.Errorf("The truncated entry was read: %v", err)
+	}
+}
+
+func Test_FileStore_sessions(t *testing.T) {
+	fs, _ := NewFileStore(t.TempDir())
+	useTestStore(t, fs)
+	id := startTestSession()
+	id.Set("name", "value")
+	restartMemory([]SessionId{id})
+	// work check
+	if id.Get("name") != "value" { // calling the tested function
+		t.Error("The session was not loaded from the files.")
+	}
+
+	b, _ := fs.Load(string(id.key()))
+	rec, err := DecodeRecord(string(id.key()), b) // calling the tested function
+	// work check
+	if err != nil || rec.Data["name"] != "value" || rec.Handle != id.key().handle() {
+		t.Errorf("Incorrect record: %+v %v", rec, err)
+	}
+	id.destroyS()
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_FileStore_Save(b *testing.B) {
+	fs, _ := NewFileStore(b.TempDir())
+	data := make([]byte, 512)
+	future := time.Now().Unix() + 60
+	for i := 0; i < b.N; i++ {
+		fs.Save("key", data, future) // calling the tested function
+	}
+}
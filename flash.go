@@ -0,0 +1,90 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+// The FlashKind type is the category of the flash message
+type FlashKind string
+
+const (
+	GOSESSION_FLASH_INFO    FlashKind = "info"    // Informational message
+	GOSESSION_FLASH_SUCCESS FlashKind = "success" // Message about a successful action
+	GOSESSION_FLASH_WARNING FlashKind = "warning" // Warning message
+	GOSESSION_FLASH_ERROR   FlashKind = "error"   // Error message
+)
+
+// The Flash type is a one-time message that is shown to the client on the next page
+type Flash struct {
+	Kind    FlashKind
+	Message string
+}
+
+// The FlashList type is a list of flash messages prepared for rendering in html/template
+type FlashList []Flash
+
+// The OfKind(kind) FlashList-method returns only messages of the specified category.
+// In the template: {{range .Flashes.OfKind "error"}}{{.Message}}{{end}}
+func (fl FlashList) OfKind(kind FlashKind) FlashList {
+	res := make(FlashList, 0, len(fl))
+	for _, f := range fl {
+		if f.Kind == kind {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// The Messages() FlashList-method returns only the texts of the messages
+func (fl FlashList) Messages() []string {
+	res := make([]string, 0, len(fl))
+	for _, f := range fl {
+		res = append(res, f.Message)
+	}
+	return res
+}
+
+// The addFlashesS() method safely appends flash messages to the session
+func (id SessionId) addFlashesS(flashes ...Flash) {
+	id.updateS(func(ses *internalSession) {
+		ses.flashes = append(ses.flashes[:len(ses.flashes):len(ses.flashes)], flashes...)
+	})
+}
+
+// The AddFlash(kind, msg) SessionId-method adds a message that will be shown on the next page, for example after a redirect.
+// kind - message category.
+// msg - message text.
+func (id SessionId) AddFlash(kind FlashKind, msg string) {
+	id.addFlashesS(Flash{Kind: kind, Message: msg})
+}
+
+// The Flashes() SessionId-method reads and removes all flash messages of the session in one operation
+func (id SessionId) Flashes() FlashList {
+	res := FlashList{}
+	if ses, _ := id.readS(); len(ses.flashes) == 0 {
+		return res // nothing to remove, the session is not written
+	}
+	id.updateS(func(ses *internalSession) {
+		if len(ses.flashes) != 0 {
+			res = FlashList(ses.flashes)
+			ses.flashes = nil
+		}
+	})
+	return res
+}
+
+// The PeekFlashes() SessionId-method reads the flash messages without removing them
+func (id SessionId) PeekFlashes() FlashList {
+	ses, _ := id.readS()
+	res := make(FlashList, len(ses.flashes))
+	copy(res, ses.flashes)
+	return res
+}
+
+// The KeepFlashes(flashes) SessionId-method returns the read messages to the session so that they survive one more request
+func (id SessionId) KeepFlashes(flashes ...Flash) {
+	if len(flashes) == 0 {
+		return
+	}
+	id.addFlashesS(flashes...)
+}
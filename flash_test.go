@@ -0,0 +1,134 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"testing"
+	"time"
+)
+
+// --------------
+// Test functions
+// --------------
+
+func Test_AddFlash(t *testing.T) {
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		id := generateId()
+		allSessions[id] = internalSession{
+			expiration: time.Now().Unix() + setingsSession.Expiration,
+			data:       make(Session),
+		}
+
+		msg := fmt.Sprintf("test message %d", i)
+		id.AddFlash(GOSESSION_FLASH_SUCCESS, msg) // calling the tested function
+		// work check
+		if len(allSessions[id].flashes) != 1 || allSessions[id].flashes[0].Message != msg {
+			t.Error("Failed to add flash message.")
+		}
+	}
+}
+
+func Test_Flashes(t *testing.T) {
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		id := generateId()
+		allSessions[id] = internalSession{
+			expiration: time.Now().Unix() + setingsSession.Expiration,
+			data:       make(Session),
+		}
+		id.AddFlash(GOSESSION_FLASH_INFO, "first")
+		id.AddFlash(GOSESSION_FLASH_ERROR, "second")
+
+		flashes := id.Flashes() // calling the tested function
+		// work check
+		if len(flashes) != 2 || flashes[0].Message != "first" || flashes[1].Kind != GOSESSION_FLASH_ERROR {
+			t.Error("Incorrect flash messages received.")
+		}
+		// work check
+		if len(id.Flashes()) != 0 {
+			t.Error("Flash messages were not cleared after reading.")
+		}
+	}
+}
+
+func Test_PeekFlashes(t *testing.T) {
+	id := generateId()
+	allSessions[id] = internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       make(Session),
+	}
+	id.AddFlash(GOSESSION_FLASH_INFO, "message")
+
+	// work check
+	if len(id.PeekFlashes()) != 1 || len(id.PeekFlashes()) != 1 { // calling the tested function
+		t.Error("Flash messages were changed by peeking.")
+	}
+}
+
+func Test_KeepFlashes(t *testing.T) {
+	id := generateId()
+	allSessions[id] = internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       make(Session),
+	}
+	id.AddFlash(GOSESSION_FLASH_WARNING, "message")
+
+	flashes := id.Flashes()
+	id.KeepFlashes(flashes...) // calling the tested function
+	// work check
+	if len(id.Flashes()) != 1 {
+		t.Error("The flash message did not survive one more request.")
+	}
+	// work check
+	if len(id.Flashes()) != 0 {
+		t.Error("The flash message survived more than one extra request.")
+	}
+}
+
+func Test_FlashList(t *testing.T) {
+	fl := FlashList{
+		{Kind: GOSESSION_FLASH_INFO, Message: "info"},
+		{Kind: GOSESSION_FLASH_ERROR, Message: "error 1"},
+		{Kind: GOSESSION_FLASH_ERROR, Message: "error 2"},
+	}
+
+	// work check
+	if len(fl.OfKind(GOSESSION_FLASH_ERROR)) != 2 { // calling the tested function
+		t.Error("Incorrect filtering by category.")
+	}
+	// work check
+	if msgs := fl.Messages(); len(msgs) != 3 || msgs[0] != "info" { // calling the tested function
+		t.Error("Incorrect list of messages.")
+	}
+
+	tmpl := template.Must(template.New("test").Parse(`{{range .OfKind "error"}}<p>{{.Message}}</p>{{end}}`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fl); err != nil {
+		t.Fatal(err)
+	}
+	// work check
+	if buf.String() != "<p>error 1</p><p>error 2</p>" {
+		t.Errorf("Incorrect template rendering: %s", buf.String())
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_AddFlash(b *testing.B) {
+	id := generateId()
+	allSessions[id] = internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       make(Session),
+	}
+
+	for i := 0; i < b.N; i++ {
+		id.AddFlash(GOSESSION_FLASH_INFO, "message") // calling the tested function
+		id.Flashes()                                 // calling the tested function
+	}
+}
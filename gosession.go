@@ -7,8 +7,13 @@ package gosession
 // --------------------------------------------------------
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -30,9 +35,22 @@ type Session map[string]interface{}
 type internalSession struct {
 	expiration int64
 	data       Session
+	csrf       []byte              // Raw CSRF token of the session
+	flashes    []Flash             // One-time messages for the next page
+	userId     string              // Identifier of the authenticated user
+	authAt     int64               // Time of the last authentication
+	authTimes  map[AuthLevel]int64 // Time of the last authentication at each level, the map is replaced and never changed
+	created    int64               // Time of the session creation
+	lastSeen   int64               // Time of the last request of the client
+	ip         string              // IP address of the client from the last request
+	userAgent  string              // User-Agent of the client from the last request
+	size       int64               // Approximate size of the session in memory, see approxSize()
+	deadlines  map[string]int64    // UnixNano deadlines of the variables set with SetWithTTL(), the map is replaced and never changed
+	links      map[string]string   // External identifiers of the session by kind, the map is replaced and never changed
 }
 
-// The serverSessions type is intended to describe all sessions of all client connections
+// The serverSessions type is intended to describe all sessions of all client connections.
+// The sessions are stored by the key of the session id, see the key() method.
 type serverSessions map[SessionId]internalSession
 
 // The GoSessionSetings type describes the settings for the session system
@@ -40,6 +58,14 @@ type GoSessionSetings struct {
 	CookieName    string
 	Expiration    int64
 	TimerCleaning time.Duration
+	HashKey       string // Secret key for storing session ids as HMAC-SHA256 hashes, empty - ids are stored as is
+	Store         Store  // Persistent storage of sessions, nil - sessions are kept only in memory
+	Lazy          bool   // New sessions are written and the cookie is sent only when the session is changed for the first time
+	Logger        Logger // Logger of session operations, nil - nothing is logged
+	Tracer        Tracer // Tracer of Start(), commits and store operations, nil - nothing is traced
+	ServerTiming  bool   // Start() and StartSecure() send the Server-Timing header with the time of reading and writing the session
+	LogFullIds    bool   // Session ids are written to the log as is, otherwise only a short prefix of their public handle
+	Clock         Clock  // Source of the current time for expiration and of the cleaner timers, nil - the system clock
 }
 
 // The allSessions variable stores all sessions of all clients
@@ -66,17 +92,31 @@ func getOrSetCookie(w *http.ResponseWriter, r *http.Request) SessionId {
 	data, err := r.Cookie(setingsSession.CookieName)
 	if err != nil {
 		id := generateId()
-		cookie := &http.Cookie{
-			Name:   setingsSession.CookieName,
-			Value:  string(id),
-			MaxAge: 0,
-		}
-		http.SetCookie(*w, cookie)
+		setCookie(w, id)
 		return id
 	}
 	return SessionId(data.Value)
 }
 
+// The setCookie(w, id) function sends the session cookie with the id to the client
+func setCookie(w *http.ResponseWriter, id SessionId) {
+	cookie := &http.Cookie{
+		Name:   setingsSession.CookieName,
+		Value:  string(id),
+		MaxAge: 0,
+	}
+	http.SetCookie(*w, cookie)
+}
+
+// The getCookieId(r) function gets the session id from the cookie without creating a new one
+func getCookieId(r *http.Request) (SessionId, bool) {
+	data, err := r.Cookie(setingsSession.CookieName)
+	if err != nil {
+		return "", false
+	}
+	return SessionId(data.Value), true
+}
+
 // The deleteCookie(w) function deletes the session cookie
 func deleteCookie(w *http.ResponseWriter) {
 	cookie := &http.Cookie{
@@ -87,78 +127,253 @@ func deleteCookie(w *http.ResponseWriter) {
 	http.SetCookie(*w, cookie)
 }
 
-// The cleaningSessions() function periodically cleans up the server's session storage
+// The cleaningSessions() function cleans up the server's session storage, it is launched periodically by the cleaner, see Open()
 func cleaningSessions() {
-	presently := time.Now().Unix()
+	start := time.Now()
+	now := clockNow()
+	presently := now.Unix()
+	removed := 0
 	block.Lock()
-	for id, ses := range allSessions {
+	for key, ses := range allSessions {
 		if ses.expiration < presently {
-			delete(allSessions, id)
+			emitLocked(GOSESSION_EVENT_EXPIRE, key, idOfKey(key), "", ses)
+			dropLocked(key)
+			removed++
+		} else if ses.hasExpiredVars(now.UnixNano()) {
+			putLocked(key, ses.withoutExpiredVars(now.UnixNano()))
 		}
 	}
-	block.Unlock()
-	// log.Println("Session storage has been serviced.")
-	time.AfterFunc(setingsSession.TimerCleaning, cleaningSessions)
+	cleaningPendingLocked(presently)
+	unlockS()
+	removed += cleaningStore(presently)
+	observeCleaner(start, removed)
+}
+
+// The key() SessionId-method returns the key under which the session is kept in the store and in the indexes.
+// If the hash key is set in the settings, this is HMAC-SHA256 of the id, so a copy of the store does not contain usable ids.
+func (id SessionId) key() SessionId {
+	if setingsSession.HashKey == "" {
+		return id
+	}
+	mac := hmac.New(sha256.New, []byte(setingsSession.HashKey))
+	mac.Write([]byte(id))
+	return SessionId(hex.EncodeToString(mac.Sum(nil)))
+}
+
+// The getLocked(key) function reads the session from memory, including the pending one, the block must be at least read-locked
+func getLocked(key SessionId) (internalSession, bool) {
+	if ses, ok := allSessions[key]; ok {
+		return ses, true
+	}
+	return getPendingLocked(key)
+}
+
+// The fetchLocked(key) function reads the session from memory or loads it from the persistent store, the block must be locked
+func fetchLocked(key SessionId) (internalSession, bool) {
+	if ses, ok := getLocked(key); ok {
+		return ses, true
+	}
+	return loadStoreLocked(key)
+}
+
+// The putLocked(key, ses) function writes the session to the store and updates the indexes, the block must be locked.
+// A lazy session is not written if its request has already ended, see materializeLocked().
+// It returns the error of writing to the persistent store, the session is kept in memory anyway.
+func putLocked(key SessionId, ses internalSession) error {
+	span := traceCommitLocked(key)
+	if !materializeLocked(key) {
+		span.end(nil)
+		return nil
+	}
+	if old, ok := allSessions[key]; ok {
+		if old.userId != ses.userId {
+			unindexUserLocked(key, old.userId)
+		}
+		unindexLinksLocked(key, old.links)
+	}
+	cacheLocked(key, ses)
+	indexUserLocked(key, ses.userId)
+	indexLinksLocked(key, ses.links)
+	err := saveStoreLocked(key, ses)
+	span.end(err)
+	return err
+}
+
+// The dropLocked(key) function deletes the session from the store and from the indexes, the block must be locked
+func dropLocked(key SessionId) {
+	if old, ok := allSessions[key]; ok {
+		unindexUserLocked(key, old.userId)
+		unindexLinksLocked(key, old.links)
+		memoryBytes -= old.size
+	}
+	unindexEvictedLocked(key)
+	unindexHandleLocked(key)
+	delete(allSessions, key)
+	forgetPendingLocked(key)
+	if setingsSession.Store != nil {
+		storeDeleteLocked(setingsSession.Store, string(key))
+	}
 }
 
 // The writeS() method safely writes data to the session store
 func (id SessionId) writeS(iSes internalSession) {
-	block.Lock()
-	allSessions[id] = iSes
-	block.Unlock()
+	id.writeCtxS(context.Background(), iSes)
+}
+
+// The writeCtxS(ctx, iSes) method safely writes data to the session store for the request, the spans of the writing are children of ctx
+func (id SessionId) writeCtxS(ctx context.Context, iSes internalSession) {
+	lockS(ctx)
+	putLocked(id.key(), iSes)
+	unlockS()
 }
 
 // The readS() method safely reads data from the session store.
 func (id SessionId) readS() (internalSession, bool) {
+	return id.readCtxS(context.Background())
+}
+
+// The readCtxS(ctx) method safely reads data from the session store for the request, the spans of the reading are children of ctx
+func (id SessionId) readCtxS(ctx context.Context) (internalSession, bool) {
+	key := id.key()
 	block.RLock()
-	defer block.RUnlock()
-	ses, ok := allSessions[id]
+	ses, ok := getLocked(key)
+	block.RUnlock()
+	if !ok && setingsSession.Store != nil {
+		lockS(ctx)
+		ses, ok = fetchLocked(key)
+		unlockS()
+	}
 	if !ok {
 		return internalSession{}, false
 	}
 	return ses, true
 }
 
+// The updateS(change) method safely changes the session in the store, nothing happens if there is no session
+func (id SessionId) updateS(change func(ses *internalSession)) bool {
+	key := id.key()
+	block.Lock()
+	defer unlockS()
+	ses, ok := fetchLocked(key)
+	if !ok {
+		return false
+	}
+	change(&ses)
+	putLocked(key, ses)
+	return true
+}
+
 // The destroyS() method safely deletes the entire session from the store.
 func (id SessionId) destroyS() {
 	block.Lock()
-	delete(allSessions, id)
-	block.Unlock()
+	destroyLocked(id.key(), id)
+	unlockS()
+}
+
+// The setS(name, value, deadline) method safely sets the client variable if the session does not exceed the size limit
+// and can be written to the persistent store.
+// name - session variable name.
+// value - directly variable in session.
+// deadline - UnixNano time after which the variable is absent, 0 - the variable lives as long as the session.
+func (id SessionId) setS(name string, value interface{}, deadline int64) error {
+	key := id.key()
+	block.Lock()
+	defer unlockS()
+	ses, ok := fetchLocked(key)
+	if !ok {
+		return nil
+	}
+	before := ses
+	old, had := ses.data[name]
+	restore := func() {
+		if had {
+			ses.data[name] = old
+		} else {
+			delete(ses.data, name)
+		}
+	}
+	ses.data[name] = value
+	ses = ses.withDeadline(name, deadline)
+	if err := checkSize(key, ses); err != nil {
+		restore()
+		return err
+	}
+	if err := putLocked(key, ses); err != nil {
+		restore()
+		putLocked(key, before)
+		return err
+	}
+	emitLocked(GOSESSION_EVENT_CHANGE, key, id, "", ses)
+	return nil
+}
+
+// The dropS() method safely deletes the session from the store without the destroy event, when the session moves to a new id
+func (id SessionId) dropS() {
+	id.dropCtxS(context.Background())
+}
+
+// The dropCtxS(ctx) method safely deletes the session from the store for the request, the spans of the deleting are children of ctx
+func (id SessionId) dropCtxS(ctx context.Context) {
+	lockS(ctx)
+	dropLocked(id.key())
+	unlockS()
 }
 
 // The deleteS() method safely deletes one client variable from the session by its name
 // name - session variable name
 func (id SessionId) deleteS(name string) {
-	block.Lock()
-	ses, ok := allSessions[id]
-	if ok {
+	id.updateS(func(ses *internalSession) {
+		if _, ok := ses.data[name]; !ok {
+			return
+		}
 		delete(ses.data, name)
-		allSessions[id] = ses
+		*ses = ses.withDeadline(name, 0)
+		emitLocked(GOSESSION_EVENT_CHANGE, id.key(), id, "", *ses)
+	})
+}
+
+// The touch(r, presently) method records the time and the client of the current request in the session
+func (ses *internalSession) touch(r *http.Request, presently int64) {
+	if ses.created == 0 {
+		ses.created = presently
+	}
+	ses.lastSeen = presently
+	ses.ip = clientIP(r)
+	ses.userAgent = r.UserAgent()
+}
+
+// The clientIP(r) function returns the IP address of the client without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
-	block.Unlock()
+	return host
 }
 
 // The Set(name, value) SessionId-method to set the client variable to be stored in the session system.
+// If the session would exceed the size limit of one session, the variable is not set and ErrSessionTooLarge is returned.
+// If the session cannot be written to the persistent store, for example the type of the value is not registered with gob.Register(),
+// the variable is not set and the error of the store is returned.
 // name - session variable name.
 // value - directly variable in session.
-func (id SessionId) Set(name string, value interface{}) {
-	ses, ok := id.readS()
-	if ok {
-		ses.data[name] = value
-		id.writeS(ses)
-	}
+func (id SessionId) Set(name string, value interface{}) error {
+	return id.setS(name, value, 0)
 }
 
 // The GetAll() SessionId-method to get all client variables from the session system
 func (id SessionId) GetAll() Session {
 	ses, _ := id.readS()
-	return ses.data
+	return ses.liveData(clockNow().UnixNano())
 }
 
 // The Get(name) SessionId-method to get a specific client variable from the session system.
 // name - session variable name
 func (id SessionId) Get(name string) interface{} {
 	ses, _ := id.readS()
+	if ses.expiredVar(name, clockNow().UnixNano()) {
+		return nil
+	}
 	return ses.data[name]
 }
 
@@ -173,55 +388,89 @@ func (id SessionId) Remove(name string) {
 	id.deleteS(name)
 }
 
+// The Take(name) SessionId-method reads and removes one client variable in one operation,
+// so that a one-time value, for example a login state, can be used only once
+func (id SessionId) Take(name string) interface{} {
+	var res interface{}
+	id.updateS(func(ses *internalSession) {
+		if _, ok := ses.data[name]; !ok {
+			return
+		}
+		if !ses.expiredVar(name, clockNow().UnixNano()) {
+			res = ses.data[name]
+		}
+		delete(ses.data, name)
+		*ses = ses.withDeadline(name, 0)
+		emitLocked(GOSESSION_EVENT_CHANGE, id.key(), id, "", *ses)
+	})
+	return res
+}
+
 // The SetSetings(settings) sets new settings for the session mechanism.
 // setings - gosession.GoSessionSetings public type variable for setting new session settings
 func SetSetings(setings GoSessionSetings) {
 	setingsSession = setings
+	cleaner.reschedule()
 }
 
 // The Start(w, r) function starts the session and returns the SessionId to the handler for further use of the session mechanism.
 // This function must be run at the very beginning of the http.Handler
 func Start(w *http.ResponseWriter, r *http.Request) SessionId {
+	rt := startTrace(r, false)
+	defer rt.end(w)
+	if isLazy(r) {
+		return startLazy(w, r, false, rt)
+	}
 	id := getOrSetCookie(w, r)
-	ses, ok := id.readS()
+	ses, ok := rt.read(id)
 	if !ok {
+		checkUnknownId(r)
 		ses.data = make(Session, 0)
 	}
-	presently := time.Now().Unix()
+	presently := clockNow().Unix()
 	ses.expiration = presently + setingsSession.Expiration
-	id.writeS(ses)
+	ses.touch(r, presently)
+	rt.write(id, ses)
+	if !ok {
+		emit(GOSESSION_EVENT_CREATE, id.key(), id, "", ses)
+	}
 	return id
 }
 
 // The StartSecure(w, r) function starts the session or changes the session ID and sets new cookie to the client.
 // This function must be run at the very beginning of the http.Handler
 func StartSecure(w *http.ResponseWriter, r *http.Request) SessionId {
+	rt := startTrace(r, true)
+	defer rt.end(w)
+	if isLazy(r) {
+		return startLazy(w, r, true, rt)
+	}
 	id := getOrSetCookie(w, r)
-	ses, ok := id.readS()
+	ses, ok := rt.read(id)
 	if !ok {
+		checkUnknownId(r)
 		ses.data = make(Session, 0)
-		presently := time.Now().Unix()
+		presently := clockNow().Unix()
 		ses.expiration = presently + setingsSession.Expiration
-		id.writeS(ses)
+		ses.touch(r, presently)
+		rt.write(id, ses)
+		emit(GOSESSION_EVENT_CREATE, id.key(), id, "", ses)
 		return id
 	} else {
-		id.destroyS()
+		oldId := id
+		rt.drop(oldId)
 		id = generateId()
-		cookie := &http.Cookie{
-			Name:   setingsSession.CookieName,
-			Value:  string(id),
-			MaxAge: 0,
-		}
-		http.SetCookie(*w, cookie)
-		presently := time.Now().Unix()
+		setCookie(w, id)
+		presently := clockNow().Unix()
 		ses.expiration = presently + setingsSession.Expiration
-		id.writeS(ses)
+		ses.touch(r, presently)
+		rt.write(id, ses)
+		emit(GOSESSION_EVENT_REGENERATE, id.key(), id, oldId, ses)
 		return id
 	}
 }
 
 // Package initialization
 func init() {
-	time.AfterFunc(setingsSession.TimerCleaning, cleaningSessions)
-	// log.Println("GoSessions initialized")
+	Open()
 }
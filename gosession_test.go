@@ -151,9 +151,11 @@ func Test_cleaningSessions(t *testing.T) {
 		falseInd = rand.Intn(75)
 		trueInd = rand.Intn(50) + falseInd
 
+		block.Lock()
 		for id := range allSessions {
-			delete(allSessions, id)
+			dropLocked(id)
 		}
+		unlockS()
 
 		for fi := 0; fi < falseInd; fi++ {
 			allSessions[generateId()] = internalSession{
@@ -247,6 +249,94 @@ func Test_deleteS(t *testing.T) {
 	}
 }
 
+func Test_key(t *testing.T) {
+	id := generateId()
+	// work check
+	if id.key() != id { // calling the tested function
+		t.Error("The key without the hash key in the settings is not equal to the id.")
+	}
+
+	defer SetSetings(setingsSession)
+	hashed := setingsSession
+	hashed.HashKey = "test secret"
+	SetSetings(hashed)
+	// work check
+	if id.key() == id || id.key() != id.key() || len(id.key()) != 64 { // calling the tested function
+		t.Error("Incorrect hashed key.")
+	}
+
+	var hid SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		hid = Start(&w, r)
+		hid.Set("name", "value")
+		hid, _ = hid.Login(&w, "hashed user")
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// work check
+	if _, ok := allSessions[hid]; ok {
+		t.Error("The raw id is used as a key in the store.")
+	}
+	// work check
+	if _, ok := allSessions[hid.key()]; !ok || hid.Get("name") != "value" || !hid.IsAuthenticated() {
+		t.Error("The session is not available by the hashed key.")
+	}
+	// work check
+	if list := UserSessions("hashed user"); len(list) != 1 || list[0].Handle != hid.key().handle() {
+		t.Error("The user index does not work with hashed keys.")
+	}
+	// work check
+	if DestroyUserSessions("hashed user") != 1 || len(UserSessions("hashed user")) != 0 {
+		t.Error("The user sessions were not deleted by hashed keys.")
+	}
+}
+
+func Test_updateS(t *testing.T) {
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		id := generateId()
+		allSessions[id] = internalSession{
+			expiration: time.Now().Unix() + setingsSession.Expiration,
+			data:       make(Session),
+		}
+
+		ok := id.updateS(func(ses *internalSession) { // calling the tested function
+			ses.userId = "user"
+		})
+		// work check
+		if !ok || allSessions[id].userId != "user" {
+			t.Error("Update error. Session has not been changed.")
+		}
+		// work check
+		if _, ok := allUsers["user"][id]; !ok {
+			t.Error("Update error. The user index has not been changed.")
+		}
+		id.destroyS()
+		// work check
+		if _, ok := allUsers["user"][id]; ok {
+			t.Error("Destroy error. The session has remained in the user index.")
+		}
+	}
+
+	// work check
+	if generateId().updateS(func(ses *internalSession) {}) { // calling the tested function
+		t.Error("Update error. A nonexistent session was changed.")
+	}
+}
+
+func Test_clientIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	// work check
+	if clientIP(r) != "192.0.2.1" { // calling the tested function
+		t.Error("Incorrect client IP address.")
+	}
+	r.RemoteAddr = "192.0.2.1"
+	// work check
+	if clientIP(r) != "192.0.2.1" { // calling the tested function
+		t.Error("Incorrect client IP address without port.")
+	}
+}
+
 func Test_Set(t *testing.T) {
 	var value interface{}
 	rand.Seed(time.Now().Unix())
@@ -444,6 +534,26 @@ func Test_Remove(t *testing.T) {
 	}
 }
 
+func Test_Take(t *testing.T) {
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		id := generateId()
+		value := fmt.Sprintf("test string %d", i)
+		allSessions[id] = internalSession{
+			expiration: time.Now().Unix() + setingsSession.Expiration,
+			data:       Session{"test name": value},
+		}
+
+		// work check
+		if id.Take("test name") != value { // calling the tested function
+			t.Error("Failed to take the variable.")
+		}
+		// work check
+		if id.Take("test name") != nil { // calling the tested function
+			t.Error("The variable was taken twice.")
+		}
+	}
+}
+
 func Test_SetSetings(t *testing.T) {
 	var test_setingsSession1 = GoSessionSetings{
 		CookieName:    "test_name",
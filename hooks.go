@@ -0,0 +1,233 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// The EventKind type defines what happened to the session
+type EventKind int
+
+const (
+	GOSESSION_EVENT_CREATE     EventKind = iota // A new session is created
+	GOSESSION_EVENT_REGENERATE                  // The session id is changed, for example at login
+	GOSESSION_EVENT_DESTROY                     // The session is destroyed by the application or evicted without a persistent store
+	GOSESSION_EVENT_EXPIRE                      // The expired session is deleted by the cleaner
+	GOSESSION_EVENT_CHANGE                      // A session variable is set or removed
+)
+
+// The String() EventKind-method returns the name of the kind of event
+func (kind EventKind) String() string {
+	switch kind {
+	case GOSESSION_EVENT_CREATE:
+		return "create"
+	case GOSESSION_EVENT_REGENERATE:
+		return "regenerate"
+	case GOSESSION_EVENT_DESTROY:
+		return "destroy"
+	case GOSESSION_EVENT_EXPIRE:
+		return "expire"
+	case GOSESSION_EVENT_CHANGE:
+		return "change"
+	}
+	return "event(" + strconv.Itoa(int(kind)) + ")"
+}
+
+// The SessionEvent type describes the event passed to the hooks
+type SessionEvent struct {
+	Kind   EventKind
+	Id     SessionId // Session id, it is empty if it is unknown (the cleaner with HashKey in the settings knows only the store key)
+	OldId  SessionId // Previous session id for GOSESSION_EVENT_REGENERATE
+	Handle string    // Public handle of the session, see SessionInfo
+	UserId string    // Identifier of the authenticated user
+	Data   Session   // Copy of the session variables
+}
+
+// The Hook type is the function called on the session event
+type Hook func(event SessionEvent)
+
+// The hookRegistry type stores the hooks of each kind of event
+type hookRegistry struct {
+	mu    sync.RWMutex
+	hooks map[EventKind][]Hook
+}
+
+// The queuedEvent type is the event that happened under the block, the hooks are called after the block is released
+type queuedEvent struct {
+	event SessionEvent
+	hooks []Hook
+}
+
+// The allHooks variable stores the registered hooks
+var allHooks = &hookRegistry{hooks: make(map[EventKind][]Hook)}
+
+// The queuedEvents variable stores the events that are waiting for the block to be released, it is protected by the block
+var queuedEvents []queuedEvent
+
+// The queuedOutput variable stores the log records and the spans made under the block, it is protected by the block.
+// They are reported by unlockS() after the block is released, so that a slow logger or tracer does not stall the sessions.
+var queuedOutput []func()
+
+// The lockedCtx variable stores the context of the request the block is locked for, it is protected by the block
+var lockedCtx context.Context
+
+// The add(kind, hook) hookRegistry-method registers the hook
+func (hr *hookRegistry) add(kind EventKind, hook Hook) {
+	hr.mu.Lock()
+	hr.hooks[kind] = append(hr.hooks[kind][:len(hr.hooks[kind]):len(hr.hooks[kind])], hook)
+	hr.mu.Unlock()
+}
+
+// The get(kind) hookRegistry-method returns the hooks of the event, the returned slice is never changed
+func (hr *hookRegistry) get(kind EventKind) []Hook {
+	hr.mu.RLock()
+	defer hr.mu.RUnlock()
+	return hr.hooks[kind]
+}
+
+// The idOfKey(key) function returns the session id by its store key if the ids are not hashed
+func idOfKey(key SessionId) SessionId {
+	if setingsSession.HashKey != "" {
+		return ""
+	}
+	return key
+}
+
+// The newEvent(kind, key, id, oldId, ses) function describes the event with a copy of the session variables
+func newEvent(kind EventKind, key SessionId, id SessionId, oldId SessionId, ses internalSession) SessionEvent {
+	live := ses.liveData(clockNow().UnixNano())
+	data := make(Session, len(live))
+	for k, v := range live {
+		data[k] = v
+	}
+	return SessionEvent{
+		Kind:   kind,
+		Id:     id,
+		OldId:  oldId,
+		Handle: key.handle(),
+		UserId: ses.userId,
+		Data:   data,
+	}
+}
+
+// The emitLocked(kind, key, id, oldId, ses) function queues the event, the hooks are called by unlockS(), the block must be locked.
+// key - store key of the session.
+// id, oldId - session ids if they are known.
+func emitLocked(kind EventKind, key SessionId, id SessionId, oldId SessionId, ses internalSession) {
+	countEvent(kind)
+	if setingsSession.Logger != nil {
+		queueLocked(func() {
+			logEvent(kind, key, id, oldId)
+		})
+	}
+	hooks := allHooks.get(kind)
+	if len(hooks) == 0 {
+		return
+	}
+	queuedEvents = append(queuedEvents, queuedEvent{event: newEvent(kind, key, id, oldId, ses), hooks: hooks})
+}
+
+// The emit(kind, key, id, oldId, ses) function calls the hooks of the event at once, the block must not be locked
+func emit(kind EventKind, key SessionId, id SessionId, oldId SessionId, ses internalSession) {
+	countEvent(kind)
+	logEvent(kind, key, id, oldId)
+	hooks := allHooks.get(kind)
+	if len(hooks) == 0 {
+		return
+	}
+	callHooks(newEvent(kind, key, id, oldId, ses), hooks)
+}
+
+// The callHooks(event, hooks) function calls the hooks, a panic in one hook does not stop the others and the session system
+func callHooks(event SessionEvent, hooks []Hook) {
+	for _, hook := range hooks {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					session := redactHandle(event.Handle)
+					if setingsSession.LogFullIds && event.Id != "" {
+						session = string(event.Id)
+					}
+					logS(GOSESSION_LOG_ERROR, "session hook panicked", "event", event.Kind, "session", session, "panic", p)
+				}
+			}()
+			hook(event)
+		}()
+	}
+}
+
+// The lockS(ctx) function locks the block for the request, the spans of the operations made under the block are children of ctx
+func lockS(ctx context.Context) {
+	block.Lock()
+	lockedCtx = ctx
+}
+
+// The queueLocked(report) function queues the log record or the span made under the block for unlockS(), the block must be locked
+func queueLocked(report func()) {
+	queuedOutput = append(queuedOutput, report)
+}
+
+// The unlockS() function releases the block, then reports the log records and the spans and calls the hooks of the events that happened under it
+func unlockS() {
+	output := queuedOutput
+	events := queuedEvents
+	queuedOutput = nil
+	queuedEvents = nil
+	lockedCtx = nil
+	block.Unlock()
+	for _, report := range output {
+		report()
+	}
+	for _, qe := range events {
+		callHooks(qe.event, qe.hooks)
+	}
+}
+
+// The destroyLocked(key, id) function destroys the session and queues the destroy event, the block must be locked
+func destroyLocked(key SessionId, id SessionId) {
+	ses, ok := allSessions[key]
+	if !ok {
+		ses, ok = evictedLocked(key)
+	}
+	if ok {
+		emitLocked(GOSESSION_EVENT_DESTROY, key, id, "", ses)
+	}
+	dropLocked(key)
+}
+
+// The OnCreate(hook) function registers the hook called when a new session is created
+func OnCreate(hook Hook) {
+	allHooks.add(GOSESSION_EVENT_CREATE, hook)
+}
+
+// The OnRegenerate(hook) function registers the hook called when the session id is changed
+func OnRegenerate(hook Hook) {
+	allHooks.add(GOSESSION_EVENT_REGENERATE, hook)
+}
+
+// The OnDestroy(hook) function registers the hook called when the session is destroyed
+func OnDestroy(hook Hook) {
+	allHooks.add(GOSESSION_EVENT_DESTROY, hook)
+}
+
+// The OnExpire(hook) function registers the hook called when the expired session is deleted by the cleaner
+func OnExpire(hook Hook) {
+	allHooks.add(GOSESSION_EVENT_EXPIRE, hook)
+}
+
+// The OnChange(hook) function registers the hook called when a session variable is set or removed
+func OnChange(hook Hook) {
+	allHooks.add(GOSESSION_EVENT_CHANGE, hook)
+}
+
+// The ResetHooks() function removes all registered hooks
+func ResetHooks() {
+	allHooks.mu.Lock()
+	allHooks.hooks = make(map[EventKind][]Hook)
+	allHooks.mu.Unlock()
+}
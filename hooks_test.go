@@ -0,0 +1,202 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The eventRecorder type collects the events passed to the hooks
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []SessionEvent
+}
+
+// The record(event) eventRecorder-method is the hook that saves the event
+func (er *eventRecorder) record(event SessionEvent) {
+	er.mu.Lock()
+	er.events = append(er.events, event)
+	er.mu.Unlock()
+}
+
+// The kinds() eventRecorder-method returns the kinds of the saved events and forgets them
+func (er *eventRecorder) kinds() []EventKind {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	res := make([]EventKind, 0, len(er.events))
+	for _, event := range er.events {
+		res = append(res, event.Kind)
+	}
+	er.events = nil
+	return res
+}
+
+// The useTestHooks(t) function registers the recorder for all events until the end of the test
+func useTestHooks(t *testing.T) *eventRecorder {
+	er := &eventRecorder{}
+	OnCreate(er.record)
+	OnRegenerate(er.record)
+	OnDestroy(er.record)
+	OnExpire(er.record)
+	OnChange(er.record)
+	t.Cleanup(ResetHooks)
+	return er
+}
+
+// The equalKinds(a, b) function compares the lists of kinds of events
+func equalKinds(a []EventKind, b ...EventKind) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_hooks_lifecycle(t *testing.T) {
+	er := useTestHooks(t)
+
+	var id SessionId
+	var w http.ResponseWriter = httptest.NewRecorder()
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		id = Start(&rw, r)
+	}
+	handler(w, httptest.NewRequest("GET", "/", nil)) // calling the tested function
+	// work check
+	if kinds := er.kinds(); !equalKinds(kinds, GOSESSION_EVENT_CREATE) {
+		t.Errorf("Incorrect events of Start: %v", kinds)
+	}
+
+	id.Set("cart", "item")
+	id.Remove("cart")
+	id.Remove("missing")
+	// work check
+	if kinds := er.kinds(); !equalKinds(kinds, GOSESSION_EVENT_CHANGE, GOSESSION_EVENT_CHANGE) {
+		t.Errorf("Incorrect events of changes: %v", kinds)
+	}
+
+	id.Set("cart", "item")
+	er.kinds()
+	oldId := id
+	id, _ = id.Login(&w, "hook user") // calling the tested function
+	er.mu.Lock()
+	event := er.events[0]
+	er.mu.Unlock()
+	// work check
+	if kinds := er.kinds(); !equalKinds(kinds, GOSESSION_EVENT_REGENERATE) || event.OldId != oldId || event.Id != id || event.Data["cart"] != "item" {
+		t.Errorf("Incorrect events of Login: %v", kinds)
+	}
+
+	id.Destroy(&w) // calling the tested function
+	// work check
+	if kinds := er.kinds(); !equalKinds(kinds, GOSESSION_EVENT_DESTROY) {
+		t.Errorf("Incorrect events of Destroy: %v", kinds)
+	}
+}
+
+func Test_hooks_StartSecure(t *testing.T) {
+	er := useTestHooks(t)
+
+	w := httptest.NewRecorder()
+	var id SessionId
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		id = StartSecure(&rw, r)
+	}
+	handler(w, httptest.NewRequest("GET", "/", nil)) // calling the tested function
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(w.Result().Cookies()[0])
+	handler(httptest.NewRecorder(), r) // calling the tested function
+	// work check
+	if kinds := er.kinds(); !equalKinds(kinds, GOSESSION_EVENT_CREATE, GOSESSION_EVENT_REGENERATE) {
+		t.Errorf("Incorrect events of StartSecure: %v", kinds)
+	}
+	id.destroyS()
+}
+
+func Test_hooks_expire(t *testing.T) {
+	id := startTestSession()
+	id.Set("cart", "abandoned")
+	er := useTestHooks(t)
+
+	block.Lock()
+	ses := allSessions[id.key()]
+	ses.expiration = time.Now().Unix() - 1
+	allSessions[id.key()] = ses
+	block.Unlock()
+	cleaningSessions() // calling the tested function
+
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	var found []SessionEvent
+	for _, event := range er.events {
+		if event.Id == id {
+			found = append(found, event)
+		}
+	}
+	// work check
+	if len(found) != 1 || found[0].Kind != GOSESSION_EVENT_EXPIRE || found[0].Data["cart"] != "abandoned" {
+		t.Errorf("Incorrect events of the cleaner: %v", found)
+	}
+}
+
+func Test_hooks_panic(t *testing.T) {
+	er := useTestHooks(t)
+	OnCreate(func(event SessionEvent) {
+		panic("hook failure")
+	})
+	OnCreate(er.record)
+
+	id := startTestSession() // calling the tested function
+	// work check
+	if kinds := er.kinds(); !equalKinds(kinds, GOSESSION_EVENT_CREATE, GOSESSION_EVENT_CREATE) {
+		t.Errorf("The panic stopped other hooks: %v", kinds)
+	}
+	// work check
+	if _, ok := id.readS(); !ok {
+		t.Error("The panic in the hook broke the session.")
+	}
+}
+
+func Test_hooks_reentrant(t *testing.T) {
+	// hooks may use the session system, they are called after the block is released
+	t.Cleanup(ResetHooks)
+	OnChange(func(event SessionEvent) {
+		if event.Data["counter"] == 1 {
+			event.Id.Set("counter", 2)
+		}
+	})
+	id := startTestSession()
+	id.Set("counter", 1) // calling the tested function
+	// work check
+	if id.Get("counter") != 2 {
+		t.Error("The hook could not change the session.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_emitLocked(b *testing.B) {
+	OnChange(func(event SessionEvent) {})
+	defer ResetHooks()
+	ses := internalSession{data: Session{"name": "value"}}
+	for i := 0; i < b.N; i++ {
+		block.Lock()
+		emitLocked(GOSESSION_EVENT_CHANGE, "key", "key", "", ses) // calling the tested function
+		unlockS()
+	}
+}
@@ -0,0 +1,240 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	GOSESSION_PENDING_TIMEOUT int64 = 60 // Max age of a session that was started but never written, in seconds
+)
+
+// The ExcludeSetings type describes the requests for which the LazySessions() middleware does not create new sessions.
+// A nil field is replaced with the default value, an empty slice disables the rule.
+type ExcludeSetings struct {
+	Methods      []string // HTTP methods, by default HEAD and OPTIONS
+	PathPrefixes []string // Path prefixes, for example "/static/"
+	Extensions   []string // File extensions of static assets, for example ".css"
+}
+
+// The pendingSession type is a session that was started in the lazy mode and has not been written yet
+type pendingSession struct {
+	id       SessionId            // Session id, it differs from the key if the ids are hashed
+	w        *http.ResponseWriter // Writer for sending the cookie when the session is written, it is valid only until ctx is done
+	ctx      context.Context      // Context of the request, it is done when the handler returns
+	ses      internalSession
+	deadline int64 // Time after which the session is forgotten
+	timer    Timer // Timer that forgets the session at the deadline
+}
+
+// The lazyRequest type is the state of one request passed through the LazySessions() middleware
+type lazyRequest struct {
+	excluded bool
+	keys     []SessionId // Keys of the pending sessions started during the request
+}
+
+// The lazyContextKey type is the key of the lazyRequest in the request context
+type lazyContextKey struct{}
+
+// Default exclusion rules
+var (
+	defaultExcludeMethods    = []string{http.MethodHead, http.MethodOptions}
+	defaultExcludeExtensions = []string{".css", ".js", ".map", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico", ".webp", ".woff", ".woff2", ".ttf"}
+)
+
+// Exclusion rules settings variable
+var setingsExclude = ExcludeSetings{
+	Methods:    defaultExcludeMethods,
+	Extensions: defaultExcludeExtensions,
+}
+
+// The pendingSessions variable stores the sessions that were started but not written, by the key of the session id
+var pendingSessions = make(map[SessionId]pendingSession)
+
+// The isExcluded(r) function checks the request against the exclusion rules
+func isExcluded(r *http.Request) bool {
+	for _, method := range setingsExclude.Methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	for _, prefix := range setingsExclude.PathPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	ext := strings.ToLower(path.Ext(r.URL.Path))
+	if ext == "" {
+		return false
+	}
+	for _, e := range setingsExclude.Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// The lazyState(r) function returns the state of the request if it passed through the LazySessions() middleware
+func lazyState(r *http.Request) *lazyRequest {
+	lr, _ := r.Context().Value(lazyContextKey{}).(*lazyRequest)
+	return lr
+}
+
+// The isLazy(r) function reports whether the session of the request must be started lazily
+func isLazy(r *http.Request) bool {
+	if setingsSession.Lazy {
+		return true
+	}
+	lr := lazyState(r)
+	return lr != nil && lr.excluded
+}
+
+// The getPendingLocked(key) function reads the pending session, the block must be at least read-locked
+func getPendingLocked(key SessionId) (internalSession, bool) {
+	p, ok := pendingSessions[key]
+	return p.ses, ok
+}
+
+// The materializeLocked(key) function sends the cookie of the pending session when it is written for the first time, the block must be locked.
+// It returns false if the request of the pending session has ended, then the cookie cannot be sent and the session must not be written.
+func materializeLocked(key SessionId) bool {
+	p, ok := pendingSessions[key]
+	if !ok {
+		return true
+	}
+	forgetPendingLocked(key)
+	if p.ctx.Err() != nil {
+		logLocked(GOSESSION_LOG_WARN, "lazy session changed after its request ended", "session", logKey(key, p.id))
+		return false
+	}
+	setCookie(p.w, p.id)
+	emitLocked(GOSESSION_EVENT_CREATE, key, p.id, "", p.ses)
+	return true
+}
+
+// The forgetPendingLocked(key) function forgets the pending session and stops its timer, the block must be locked
+func forgetPendingLocked(key SessionId) {
+	p, ok := pendingSessions[key]
+	if !ok {
+		return
+	}
+	p.timer.Stop()
+	delete(pendingSessions, key)
+}
+
+// The forgetPendingS(key) function safely forgets the pending session when its deadline has come
+func forgetPendingS(key SessionId) {
+	block.Lock()
+	forgetPendingLocked(key)
+	unlockS()
+}
+
+// The cleaningPendingLocked(presently) function forgets the pending sessions that were never written, the block must be locked
+func cleaningPendingLocked(presently int64) {
+	for key, p := range pendingSessions {
+		if p.deadline < presently {
+			forgetPendingLocked(key)
+		}
+	}
+}
+
+// The startPending(w, r) function mints a new session id only in memory.
+// The session is written and the cookie is sent when the session is changed for the first time during the request,
+// the session is forgotten when it is not changed within GOSESSION_PENDING_TIMEOUT or its request ends before that.
+func startPending(w *http.ResponseWriter, r *http.Request) SessionId {
+	id := generateId()
+	key := id.key()
+	presently := clockNow().Unix()
+	ses := internalSession{
+		expiration: presently + setingsSession.Expiration,
+		data:       make(Session, 0),
+	}
+	ses.touch(r, presently)
+	block.Lock()
+	pendingSessions[key] = pendingSession{
+		id:       id,
+		w:        w,
+		ctx:      r.Context(),
+		ses:      ses,
+		deadline: presently + GOSESSION_PENDING_TIMEOUT,
+		timer: currentClock().AfterFunc(time.Duration(GOSESSION_PENDING_TIMEOUT)*time.Second, func() {
+			forgetPendingS(key)
+		}),
+	}
+	unlockS()
+	if lr := lazyState(r); lr != nil {
+		lr.keys = append(lr.keys, key)
+	}
+	return id
+}
+
+// The startLazy(w, r, secure, rt) function starts the session in the lazy mode.
+// An existing session is continued as usual, but it is not prolonged by the excluded requests.
+// secure - change the id of an existing session, as StartSecure() does.
+// rt - tracing of the calling Start() or StartSecure().
+func startLazy(w *http.ResponseWriter, r *http.Request, secure bool, rt *requestTrace) SessionId {
+	id, presented := getCookieId(r)
+	if !presented {
+		return startPending(w, r)
+	}
+	ses, ok := rt.read(id)
+	if !ok {
+		checkUnknownId(r)
+		return startPending(w, r)
+	}
+	if lr := lazyState(r); lr != nil && lr.excluded {
+		return id
+	}
+	oldId := id
+	if secure {
+		rt.drop(oldId)
+		id = generateId()
+		setCookie(w, id)
+	}
+	presently := clockNow().Unix()
+	ses.expiration = presently + setingsSession.Expiration
+	ses.touch(r, presently)
+	rt.write(id, ses)
+	if secure {
+		emit(GOSESSION_EVENT_REGENERATE, id.key(), id, oldId, ses)
+	}
+	return id
+}
+
+// The LazySessions(next) middleware applies the exclusion rules: for static assets, HEAD and OPTIONS requests
+// Start() and StartSecure() do not create new sessions and do not prolong the existing ones.
+// After the handler the sessions that were started but never written are forgotten.
+func LazySessions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lr := &lazyRequest{excluded: isExcluded(r)}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), lazyContextKey{}, lr)))
+		if len(lr.keys) == 0 {
+			return
+		}
+		block.Lock()
+		for _, key := range lr.keys {
+			forgetPendingLocked(key)
+		}
+		unlockS()
+	})
+}
+
+// The SetExcludeSetings(setings) sets new exclusion rules for the LazySessions() middleware.
+// setings - gosession.ExcludeSetings public type variable for setting new exclusion rules
+func SetExcludeSetings(setings ExcludeSetings) {
+	if setings.Methods == nil {
+		setings.Methods = defaultExcludeMethods
+	}
+	if setings.Extensions == nil {
+		setings.Extensions = defaultExcludeExtensions
+	}
+	setingsExclude = setings
+}
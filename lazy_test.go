@@ -0,0 +1,243 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// The useLazyMode(t) function enables the lazy mode until the end of the test
+func useLazyMode(t *testing.T) {
+	old := setingsSession
+	lazy := setingsSession
+	lazy.Lazy = true
+	SetSetings(lazy)
+	t.Cleanup(func() {
+		SetSetings(old)
+	})
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_isExcluded(t *testing.T) {
+	SetExcludeSetings(ExcludeSetings{PathPrefixes: []string{"/static/"}})
+	defer SetExcludeSetings(ExcludeSetings{})
+
+	cases := []struct {
+		method string
+		path   string
+		res    bool
+	}{
+		{"GET", "/", false},
+		{"POST", "/login", false},
+		{"HEAD", "/", true},
+		{"OPTIONS", "/api", true},
+		{"GET", "/static/page", true},
+		{"GET", "/css/main.CSS", true},
+		{"GET", "/favicon.ico", true},
+		{"GET", "/report.pdf", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		// work check
+		if isExcluded(r) != c.res { // calling the tested function
+			t.Errorf("Incorrect exclusion of %s %s", c.method, c.path)
+		}
+	}
+}
+
+func Test_Start_lazy(t *testing.T) {
+	useLazyMode(t)
+
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		var id SessionId
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			id = Start(&w, r) // calling the tested function
+			io.WriteString(w, "OK")
+		}
+
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/", nil))
+		// work check
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("The cookie was sent for an unchanged session.")
+		}
+		block.RLock()
+		_, stored := allSessions[id.key()]
+		block.RUnlock()
+		// work check
+		if stored {
+			t.Error("The unchanged session was stored.")
+		}
+		id.destroyS()
+	}
+
+	var id SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = Start(&w, r) // calling the tested function
+		id.Set("name", "value")
+		io.WriteString(w, "OK")
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	// work check
+	if len(cookies) != 1 || cookies[0].Value != string(id) {
+		t.Fatal("The cookie was not sent after the first change.")
+	}
+	// work check
+	if id.Get("name") != "value" {
+		t.Error("The session was not stored after the first change.")
+	}
+
+	// the next request continues the stored session
+	var id2 SessionId
+	handler2 := func(w http.ResponseWriter, r *http.Request) {
+		id2 = Start(&w, r) // calling the tested function
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	handler2(httptest.NewRecorder(), r)
+	// work check
+	if id2 != id {
+		t.Error("The stored session was not continued.")
+	}
+}
+
+func Test_LazySessions(t *testing.T) {
+	var id SessionId
+	var expiration int64
+	handler := LazySessions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = Start(&w, r)
+		ses, _ := id.readS()
+		expiration = ses.expiration
+	}))
+
+	// the excluded request does not create the session
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/main.css", nil)) // calling the tested function
+	block.RLock()
+	_, pending := pendingSessions[id.key()]
+	_, stored := allSessions[id.key()]
+	block.RUnlock()
+	// work check
+	if len(w.Result().Cookies()) != 0 || pending || stored {
+		t.Error("The session was created for the excluded request.")
+	}
+
+	// the usual request creates the session
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil)) // calling the tested function
+	cookies := w.Result().Cookies()
+	// work check
+	if len(cookies) != 1 {
+		t.Fatal("The session was not created.")
+	}
+
+	// the excluded request does not prolong the existing session
+	block.Lock()
+	ses := allSessions[id.key()]
+	ses.expiration = 1
+	allSessions[id.key()] = ses
+	block.Unlock()
+	r := httptest.NewRequest("HEAD", "/", nil)
+	r.AddCookie(cookies[0])
+	handler.ServeHTTP(httptest.NewRecorder(), r) // calling the tested function
+	// work check
+	if expiration != 1 {
+		t.Error("The excluded request prolonged the session.")
+	}
+	id.destroyS()
+}
+
+func Test_cleaningPendingLocked(t *testing.T) {
+	useLazyMode(t)
+	var id SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = Start(&w, r)
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	block.Lock()
+	cleaningPendingLocked(pendingSessions[id.key()].deadline + 1) // calling the tested function
+	_, ok := pendingSessions[id.key()]
+	block.Unlock()
+	// work check
+	if ok {
+		t.Error("The pending session was not forgotten.")
+	}
+}
+
+func Test_materializeLocked_ended(t *testing.T) {
+	useLazyMode(t)
+	var id SessionId
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = Start(&w, r)
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	cancel()
+
+	id.Set("name", "value") // calling the tested function
+	block.RLock()
+	_, pending := pendingSessions[id.key()]
+	_, stored := allSessions[id.key()]
+	block.RUnlock()
+	// work check
+	if len(w.Result().Cookies()) != 0 || pending || stored {
+		t.Error("The session was written after its request ended.")
+	}
+}
+
+func Test_startPending_deadline(t *testing.T) {
+	useLazyMode(t)
+	sc := &stubClock{now: time.Now()}
+	setings := setingsSession
+	setings.Clock = sc
+	SetSetings(setings)
+	t.Cleanup(func() {
+		Close()
+		setings.Clock = nil
+		SetSetings(setings)
+		Open()
+	})
+	var id SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = startPending(&w, r) // calling the tested function
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	// work check
+	if sc.f == nil || sc.delay != time.Duration(GOSESSION_PENDING_TIMEOUT)*time.Second {
+		t.Fatal("The deadline of the pending session was not scheduled.")
+	}
+
+	sc.f()
+	block.RLock()
+	_, pending := pendingSessions[id.key()]
+	block.RUnlock()
+	// work check
+	if pending {
+		t.Error("The pending session was not forgotten at its deadline.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_isExcluded(b *testing.B) {
+	r := httptest.NewRequest("GET", "/static/css/main.css", nil)
+	for i := 0; i < b.N; i++ {
+		isExcluded(r) // calling the tested function
+	}
+}
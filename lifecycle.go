@@ -0,0 +1,143 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The Flusher interface is implemented by stores that buffer writes or work in the background.
+// Close() calls Flush() of the store from the settings, so that nothing is lost when the application stops.
+type Flusher interface {
+	// Flush writes the buffered data and waits for the background work of the store
+	Flush() error
+}
+
+// The cleanerLife type controls the periodic launch of the cleaner
+type cleanerLife struct {
+	mu     sync.Mutex
+	timer  Timer
+	period time.Duration  // Period of the scheduled timer
+	clock  Clock          // Clock of the scheduled timer
+	gen    uint64         // Generation of the timer, a timer of an old generation does nothing
+	open   bool           // The session system is open and the cleaner is scheduled
+	runs   sync.WaitGroup // Running cleaners
+}
+
+// The cleaner variable stores the state of the cleaner
+var cleaner cleanerLife
+
+// The scheduleLocked() cleanerLife-method schedules the next launch of the cleaner with the period from the settings,
+// the period of 0 or less pauses the cleaner, the mutex must be locked
+func (cl *cleanerLife) scheduleLocked() {
+	if cl.timer != nil {
+		cl.timer.Stop()
+		cl.timer = nil
+	}
+	cl.gen++
+	cl.period = setingsSession.TimerCleaning
+	cl.clock = setingsSession.Clock
+	if cl.period <= 0 {
+		return
+	}
+	gen := cl.gen
+	cl.timer = currentClock().AfterFunc(cl.period, func() {
+		cl.run(gen)
+	})
+}
+
+// The run(gen) cleanerLife-method runs the cleaner and schedules the next launch
+func (cl *cleanerLife) run(gen uint64) {
+	cl.mu.Lock()
+	if !cl.open || gen != cl.gen {
+		cl.mu.Unlock()
+		return
+	}
+	cl.runs.Add(1)
+	cl.mu.Unlock()
+	defer cl.runs.Done()
+
+	cleaningSessions()
+
+	cl.mu.Lock()
+	if cl.open && gen == cl.gen {
+		cl.scheduleLocked()
+	}
+	cl.mu.Unlock()
+}
+
+// The reschedule() cleanerLife-method schedules the cleaner again if its period or clock in the settings has changed
+func (cl *cleanerLife) reschedule() {
+	cl.mu.Lock()
+	if cl.open && (cl.period != setingsSession.TimerCleaning || !sameClock(cl.clock, setingsSession.Clock)) {
+		cl.scheduleLocked()
+	}
+	cl.mu.Unlock()
+}
+
+// The Open() function starts the periodic cleaning of obsolete sessions with the TimerCleaning period from the settings.
+// The session system is opened when the package is initialized, so Open() is needed only after Close().
+// Changing TimerCleaning or Clock with SetSetings() reschedules the cleaner, the period of 0 or less pauses it.
+func Open() {
+	cleaner.mu.Lock()
+	if !cleaner.open {
+		cleaner.open = true
+		cleaner.scheduleLocked()
+	}
+	cleaner.mu.Unlock()
+}
+
+// The Close() function stops the cleaner, waits for the running cleaning to finish and flushes the store from the settings if it is a Flusher.
+// The sessions keep working after Close(), but obsolete sessions are not removed until Open() is called.
+// It is safe to call Close() several times.
+func Close() error {
+	cleaner.mu.Lock()
+	cleaner.open = false
+	cleaner.gen++
+	if cleaner.timer != nil {
+		cleaner.timer.Stop()
+		cleaner.timer = nil
+	}
+	cleaner.mu.Unlock()
+	cleaner.runs.Wait()
+	if f, ok := setingsSession.Store.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// The CloseOnShutdown(srv) function registers Close() to be called by srv.Shutdown().
+// http.Server calls the registered functions in the background, so to be sure that the store is flushed
+// call Close() after Shutdown() returns instead.
+// srv - the HTTP server of the application.
+func CloseOnShutdown(srv *http.Server) {
+	srv.RegisterOnShutdown(func() {
+		Close()
+	})
+}
+
+// The Flush() EncryptedStore-method waits for the background re-encryption and flushes the backing store if it is a Flusher
+func (es *EncryptedStore) Flush() error {
+	es.Wait()
+	if f, ok := es.store.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// The Flush() MigratingStore-method flushes both stores if they are Flushers
+func (ms *MigratingStore) Flush() error {
+	var firstErr error
+	for _, store := range []Store{ms.to, ms.from} {
+		if f, ok := store.(Flusher); ok {
+			if err := f.Flush(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,201 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The flushingStore type is the MemoryStore that counts the calls of Flush()
+type flushingStore struct {
+	*MemoryStore
+	flushes int32
+}
+
+// The Flush() flushingStore-method counts the call
+func (fs *flushingStore) Flush() error {
+	atomic.AddInt32(&fs.flushes, 1)
+	return nil
+}
+
+// The gatedStore type is the MemoryStore whose Scan() waits until the gate is closed, if the gate is set
+type gatedStore struct {
+	*MemoryStore
+	gate chan struct{}
+}
+
+// The Scan(cursor, limit) gatedStore-method waits for the gate and lists the keys
+func (gs *gatedStore) Scan(cursor string, limit int) ([]string, string, error) {
+	if gs.gate != nil {
+		<-gs.gate
+	}
+	return gs.MemoryStore.Scan(cursor, limit)
+}
+
+// The useTestTimer(t, period) function sets the period of the cleaner and restores the settings and the open cleaner after the test.
+// The cleaner is closed before the settings are restored, so that it does not read them while they are changed.
+func useTestTimer(t *testing.T, period time.Duration) {
+	old := setingsSession
+	setings := setingsSession
+	setings.TimerCleaning = period
+	SetSetings(setings)
+	t.Cleanup(func() {
+		Close()
+		SetSetings(old)
+		Open()
+	})
+}
+
+// The waitFor(cond) function waits up to a second for the condition
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_Open_Close(t *testing.T) {
+	sc := &stubClock{now: time.Now()}
+	gs := &gatedStore{MemoryStore: NewMemoryStore()}
+	keyring, _ := NewKeyring(1, testKey(1))
+	es := NewEncryptedStore(gs, keyring)
+	old := setingsSession
+	setings := setingsSession
+	setings.TimerCleaning = time.Minute
+	setings.Clock = sc
+	setings.Store = es
+	Close()
+	SetSetings(setings)
+	t.Cleanup(func() {
+		Close()
+		SetSetings(old)
+		Open()
+	})
+	start := Metrics().Cleaner.Count
+	// the fake clock starts no goroutines, so all goroutines started from here must stop after Close()
+	baseline := runtime.NumGoroutine()
+
+	Open() // calling the tested function
+	// work check
+	if sc.f == nil || sc.delay != time.Minute {
+		t.Fatalf("The cleaner is not scheduled: %v", sc.delay)
+	}
+	sc.f()
+	// work check
+	if Metrics().Cleaner.Count != start+1 {
+		t.Fatal("The cleaner was not launched by its timer.")
+	}
+
+	// the re-encryption goroutine is held in Scan() until the gate is closed
+	gs.gate = make(chan struct{})
+	if err := es.Rotate(2, testKey(2)); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- Close() // calling the tested function
+	}()
+	select {
+	case err := <-done:
+		done <- err
+		// work check
+		t.Error("Close() did not wait for the re-encryption.")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(gs.gate)
+	// work check
+	if err := <-done; err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+	// work check
+	if !waitFor(func() bool { return runtime.NumGoroutine() <= baseline }) {
+		t.Errorf("Goroutines leaked after Close(): %d > %d", runtime.NumGoroutine(), baseline)
+	}
+
+	sc.f()
+	// work check
+	if Metrics().Cleaner.Count != start+1 {
+		t.Error("The cleaner was launched after Close().")
+	}
+	// work check
+	if err := Close(); err != nil { // calling the tested function
+		t.Error("The repeated Close() failed.")
+	}
+}
+
+func Test_SetSetings_reschedule(t *testing.T) {
+	useTestTimer(t, time.Hour)
+	start := Metrics().Cleaner.Count
+
+	setings := setingsSession
+	setings.TimerCleaning = 0
+	SetSetings(setings) // calling the tested function
+	time.Sleep(30 * time.Millisecond)
+	// work check
+	if Metrics().Cleaner.Count != start {
+		t.Error("The cleaner was not paused.")
+	}
+
+	setings.TimerCleaning = 5 * time.Millisecond
+	SetSetings(setings) // calling the tested function
+	// work check
+	if !waitFor(func() bool { return Metrics().Cleaner.Count >= start+2 }) {
+		t.Error("The cleaner was not rescheduled.")
+	}
+}
+
+func Test_Close_flush(t *testing.T) {
+	fs := &flushingStore{MemoryStore: NewMemoryStore()}
+	useTestStore(t, fs)
+	t.Cleanup(Open)
+	keyring, _ := NewKeyring(1, make([]byte, 32))
+
+	err := Close() // calling the tested function
+	// work check
+	if err != nil || fs.flushes != 1 {
+		t.Errorf("The store was not flushed: %v %v", fs.flushes, err)
+	}
+	NewMigratingStore(NewMemoryStore(), NewEncryptedStore(fs, keyring), false).Flush() // calling the tested function
+	// work check
+	if fs.flushes != 2 {
+		t.Error("The wrapped store was not flushed.")
+	}
+}
+
+func Test_CloseOnShutdown(t *testing.T) {
+	fs := &flushingStore{MemoryStore: NewMemoryStore()}
+	useTestStore(t, fs)
+	t.Cleanup(Open)
+	srv := &http.Server{}
+	CloseOnShutdown(srv) // calling the tested function
+	srv.Shutdown(context.Background())
+	// work check
+	if !waitFor(func() bool { return atomic.LoadInt32(&fs.flushes) == 1 }) {
+		t.Error("The session system was not closed on shutdown.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_Open_Close(b *testing.B) {
+	defer Open()
+	for i := 0; i < b.N; i++ {
+		Open()  // calling the tested function
+		Close() // calling the tested function
+	}
+}
@@ -0,0 +1,116 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+// The linkedSessions type is an index of session store keys by external identifier, see the linkKey() function
+type linkedSessions map[string]map[SessionId]struct{}
+
+// The allLinks variable stores the sessions of each external identifier, it is protected by the same block as allSessions
+var allLinks linkedSessions = make(linkedSessions, 0)
+
+// The linkKey(kind, value) function returns the key of the external identifier in the index
+func linkKey(kind string, value string) string {
+	return kind + "\x00" + value
+}
+
+// The indexLinksLocked(key, links) function adds the session to the index of external identifiers, the block must be locked
+func indexLinksLocked(key SessionId, links map[string]string) {
+	for kind, value := range links {
+		lk := linkKey(kind, value)
+		ids, ok := allLinks[lk]
+		if !ok {
+			ids = make(map[SessionId]struct{})
+			allLinks[lk] = ids
+		}
+		ids[key] = struct{}{}
+	}
+}
+
+// The unindexLinksLocked(key, links) function removes the session from the index of external identifiers, the block must be locked
+func unindexLinksLocked(key SessionId, links map[string]string) {
+	for kind, value := range links {
+		lk := linkKey(kind, value)
+		ids, ok := allLinks[lk]
+		if !ok {
+			continue
+		}
+		delete(ids, key)
+		if len(ids) == 0 {
+			delete(allLinks, lk)
+		}
+	}
+}
+
+// The destroyLinkedS(kind, value) function safely deletes all sessions linked to the external identifier and returns their number.
+// The sessions that are only in the persistent store are found by scanning the store.
+func destroyLinkedS(kind string, value string) int {
+	count := 0
+	block.Lock()
+	for key := range allLinks[linkKey(kind, value)] {
+		destroyLocked(key, idOfKey(key))
+		count++
+	}
+	unlockS()
+
+	store := setingsSession.Store
+	if store == nil {
+		return count
+	}
+	cursor := ""
+	for {
+		keys, next, err := storeScan(store, cursor, GOSESSION_SCAN_PAGE)
+		if err != nil {
+			return count
+		}
+		for _, key := range keys {
+			block.Lock()
+			if _, ok := allSessions[SessionId(key)]; !ok {
+				if b, err := storeLoadLocked(store, key); err == nil {
+					if ses, err := decodeSession(b); err == nil && ses.links[kind] == value {
+						emitLocked(GOSESSION_EVENT_DESTROY, SessionId(key), idOfKey(SessionId(key)), "", ses)
+						storeDeleteLocked(store, key)
+						unindexEvictedLocked(SessionId(key))
+						count++
+					}
+				}
+			}
+			unlockS()
+		}
+		if next == "" {
+			return count
+		}
+		cursor = next
+	}
+}
+
+// The Link(kind, value) SessionId-method links the session to an external identifier,
+// for example to the session of an identity provider, so that it can be destroyed by DestroyLinked().
+// The link moves with the session when its id changes, a session has one value of each kind.
+// kind - kind of the identifier, for example "oidc.sid".
+// value - identifier.
+func (id SessionId) Link(kind string, value string) {
+	id.updateS(func(ses *internalSession) {
+		links := make(map[string]string, len(ses.links)+1)
+		for k, v := range ses.links {
+			links[k] = v
+		}
+		links[kind] = value
+		ses.links = links
+	})
+}
+
+// The Linked(kind) SessionId-method returns the external identifier of the kind linked to the session
+func (id SessionId) Linked(kind string) string {
+	ses, _ := id.readS()
+	return ses.links[kind]
+}
+
+// The DestroyLinked(kind, value) function deletes all sessions linked to the external identifier and returns their number,
+// for example when the user logs out at the identity provider.
+// kind - kind of the identifier.
+// value - identifier.
+func DestroyLinked(kind string, value string) int {
+	return destroyLinkedS(kind, value)
+}
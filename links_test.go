@@ -0,0 +1,93 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// --------------
+// Test functions
+// --------------
+
+func Test_Link(t *testing.T) {
+	id := startTestSession()
+
+	id.Link("test.sid", "sid-1") // calling the tested function
+	// work check
+	if id.Linked("test.sid") != "sid-1" {
+		t.Error("The session was not linked.")
+	}
+
+	id.Link("test.sid", "sid-2") // calling the tested function
+	block.RLock()
+	_, old := allLinks[linkKey("test.sid", "sid-1")][id.key()]
+	_, linked := allLinks[linkKey("test.sid", "sid-2")][id.key()]
+	block.RUnlock()
+	// work check
+	if old || !linked {
+		t.Error("Incorrect index of external identifiers.")
+	}
+
+	// the link moves with the session when its id changes
+	var w http.ResponseWriter = httptest.NewRecorder()
+	newId, _ := id.Login(&w, "link user")
+	// work check
+	if newId.Linked("test.sid") != "sid-2" {
+		t.Error("The link was lost after the login.")
+	}
+	newId.destroyS()
+	block.RLock()
+	_, ok := allLinks[linkKey("test.sid", "sid-2")]
+	block.RUnlock()
+	// work check
+	if ok {
+		t.Error("The destroyed session stays in the index.")
+	}
+}
+
+func Test_DestroyLinked(t *testing.T) {
+	ids := make([]SessionId, 0, GOSESSION_TESTING_ITER)
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		id := startTestSession()
+		id.Link("test.sub", fmt.Sprintf("sub-%d", i%2))
+		ids = append(ids, id)
+	}
+
+	count := DestroyLinked("test.sub", "sub-0") // calling the tested function
+	// work check
+	if count != GOSESSION_TESTING_ITER/2 {
+		t.Errorf("Incorrect number of destroyed sessions: %d", count)
+	}
+	for i, id := range ids {
+		_, ok := id.readS()
+		// work check
+		if ok != (i%2 == 1) {
+			t.Error("A wrong session was destroyed.")
+		}
+	}
+	DestroyLinked("test.sub", "sub-1")
+}
+
+func Test_DestroyLinked_store(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+	id := startTestSession()
+	id.Link("test.sid", "stored")
+
+	// the session is only in the store, for example after a restart
+	block.Lock()
+	evictLocked(id.key())
+	block.Unlock()
+
+	count := DestroyLinked("test.sid", "stored") // calling the tested function
+	// work check
+	if count != 1 || ms.Len() != 0 {
+		t.Error("The stored session was not destroyed.")
+	}
+}
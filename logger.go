@@ -0,0 +1,155 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const GOSESSION_LOG_ID_LENGTH int = 8 // Length of the redacted session id in the log, a prefix of the public handle
+
+// The LogLevel type defines the importance of the log record
+type LogLevel int
+
+const (
+	GOSESSION_LOG_DEBUG LogLevel = iota // Routine operations: created and destroyed sessions, cleaner runs
+	GOSESSION_LOG_INFO                  // Changes of session ids
+	GOSESSION_LOG_WARN                  // Rejected session ids and suspicious clients
+	GOSESSION_LOG_ERROR                 // Failed store operations and panics in hooks
+)
+
+// The Logger interface is implemented by the loggers of session operations.
+// keyvals - alternating keys and values, the keys are strings.
+type Logger interface {
+	Log(level LogLevel, msg string, keyvals ...interface{})
+}
+
+// The StdLogger type is the Logger that writes the records to the standard log.Logger in the key=value format
+type StdLogger struct {
+	logger *log.Logger
+	level  LogLevel
+}
+
+// The String() LogLevel-method returns the name of the level
+func (level LogLevel) String() string {
+	switch level {
+	case GOSESSION_LOG_DEBUG:
+		return "debug"
+	case GOSESSION_LOG_INFO:
+		return "info"
+	case GOSESSION_LOG_WARN:
+		return "warn"
+	case GOSESSION_LOG_ERROR:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(level)) + ")"
+}
+
+// The NewStdLogger(logger, level) function creates the Logger that writes the records of the level and above.
+// logger - the destination, log.Default() if nil.
+func NewStdLogger(logger *log.Logger, level LogLevel) *StdLogger {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &StdLogger{logger: logger, level: level}
+}
+
+// The logValue(v) function formats the value of the record, quoting it if necessary
+func logValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// The Log(level, msg, keyvals) StdLogger-method writes the record if its level is not lower than the level of the logger
+func (sl *StdLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	if level < sl.level {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("level=")
+	sb.WriteString(level.String())
+	sb.WriteString(" msg=")
+	sb.WriteString(logValue(msg))
+	for i := 0; i < len(keyvals); i += 2 {
+		sb.WriteByte(' ')
+		sb.WriteString(fmt.Sprint(keyvals[i]))
+		sb.WriteByte('=')
+		if i+1 < len(keyvals) {
+			sb.WriteString(logValue(keyvals[i+1]))
+		} else {
+			sb.WriteString(`""`)
+		}
+	}
+	sl.logger.Print(sb.String())
+}
+
+// The logS(level, msg, keyvals) function passes the record to the logger from the settings, if any
+func logS(level LogLevel, msg string, keyvals ...interface{}) {
+	if logger := setingsSession.Logger; logger != nil {
+		logger.Log(level, msg, keyvals...)
+	}
+}
+
+// The redactHandle(handle) function shortens the public handle of the session for the log
+func redactHandle(handle string) string {
+	if len(handle) > GOSESSION_LOG_ID_LENGTH {
+		return handle[:GOSESSION_LOG_ID_LENGTH]
+	}
+	return handle
+}
+
+// The logLocked(level, msg, keyvals) function queues the record for the logger from the settings, if any,
+// the record is passed by unlockS() after the block is released, the block must be locked
+func logLocked(level LogLevel, msg string, keyvals ...interface{}) {
+	if logger := setingsSession.Logger; logger != nil {
+		queueLocked(func() {
+			logger.Log(level, msg, keyvals...)
+		})
+	}
+}
+
+// The logKey(key, id) function returns the session for the log: the short prefix of its public handle,
+// or the id as is if LogFullIds is set in the settings.
+// key - store key of the session.
+// id - session id if it is known.
+func logKey(key SessionId, id SessionId) string {
+	if key == "" {
+		return ""
+	}
+	if setingsSession.LogFullIds {
+		if id != "" {
+			return string(id)
+		}
+		return string(key)
+	}
+	return redactHandle(key.handle())
+}
+
+// The logEvent(kind, key, id, oldId) function logs the event of the session
+func logEvent(kind EventKind, key SessionId, id SessionId, oldId SessionId) {
+	if setingsSession.Logger == nil {
+		return
+	}
+	switch kind {
+	case GOSESSION_EVENT_REGENERATE:
+		old := ""
+		if oldId != "" {
+			old = logKey(oldId.key(), oldId)
+		}
+		logS(GOSESSION_LOG_INFO, "session regenerated", "session", logKey(key, id), "old", old)
+	case GOSESSION_EVENT_CREATE:
+		logS(GOSESSION_LOG_DEBUG, "session created", "session", logKey(key, id))
+	case GOSESSION_EVENT_DESTROY:
+		logS(GOSESSION_LOG_DEBUG, "session destroyed", "session", logKey(key, id))
+	case GOSESSION_EVENT_EXPIRE:
+		logS(GOSESSION_LOG_DEBUG, "session expired", "session", logKey(key, id))
+	}
+}
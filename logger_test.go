@@ -0,0 +1,181 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The logRecord type is the record saved by the testLogger
+type logRecord struct {
+	level   LogLevel
+	msg     string
+	keyvals []interface{}
+}
+
+// The testLogger type is the Logger that saves the records
+type testLogger struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+// The Log(level, msg, keyvals) testLogger-method saves the record
+func (tl *testLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	tl.mu.Lock()
+	tl.records = append(tl.records, logRecord{level: level, msg: msg, keyvals: keyvals})
+	tl.mu.Unlock()
+}
+
+// The find(msg) testLogger-method returns the first record with the message
+func (tl *testLogger) find(msg string) (logRecord, bool) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	for _, record := range tl.records {
+		if record.msg == msg {
+			return record, true
+		}
+	}
+	return logRecord{}, false
+}
+
+// The value(key) logRecord-method returns the value of the key in the record
+func (lr logRecord) value(key string) interface{} {
+	for i := 0; i+1 < len(lr.keyvals); i += 2 {
+		if lr.keyvals[i] == key {
+			return lr.keyvals[i+1]
+		}
+	}
+	return nil
+}
+
+// The useTestLogger(t, fullIds) function sets the recording logger in the settings until the end of the test
+func useTestLogger(t *testing.T, fullIds bool) *testLogger {
+	tl := &testLogger{}
+	old := setingsSession
+	withLogger := setingsSession
+	withLogger.Logger = tl
+	withLogger.LogFullIds = fullIds
+	SetSetings(withLogger)
+	t.Cleanup(func() {
+		SetSetings(old)
+	})
+	return tl
+}
+
+// The failingStore type is the Store whose operations fail
+type failingStore struct {
+	*MemoryStore
+}
+
+// The Save(key, data, expiration) failingStore-method always fails
+func (fs *failingStore) Save(key string, data []byte, expiration int64) error {
+	return errors.New("disk is full")
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_StdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	sl := NewStdLogger(log.New(&buf, "", 0), GOSESSION_LOG_INFO)
+	sl.Log(GOSESSION_LOG_DEBUG, "hidden")                                         // calling the tested function
+	sl.Log(GOSESSION_LOG_WARN, "unknown session id", "session", "ab12", "ip", "") // calling the tested function
+	sl.Log(GOSESSION_LOG_ERROR, "failed", "error", "disk is full", "odd")         // calling the tested function
+	want := "level=warn msg=\"unknown session id\" session=ab12 ip=\"\"\n" +
+		"level=error msg=failed error=\"disk is full\" odd=\"\"\n"
+	// work check
+	if buf.String() != want {
+		t.Errorf("Incorrect records:\n%s", buf.String())
+	}
+}
+
+func Test_logKey(t *testing.T) {
+	useTestLogger(t, false)
+	id := generateId()
+	res := logKey(id.key(), id) // calling the tested function
+	// work check
+	if len(res) != GOSESSION_LOG_ID_LENGTH || strings.Contains(string(id), res) || !strings.HasPrefix(id.key().handle(), res) {
+		t.Errorf("The id is not redacted: %v", res)
+	}
+
+	useTestLogger(t, true)
+	// work check
+	if res := logKey(id.key(), id); res != string(id) { // calling the tested function
+		t.Errorf("The full id is not logged: %v", res)
+	}
+}
+
+func Test_logging(t *testing.T) {
+	tl := useTestLogger(t, false)
+
+	var w http.ResponseWriter = httptest.NewRecorder()
+	id := startTestSession()
+	newId, _ := id.Login(&w, "log user") // calling the tested function
+	record, ok := tl.find("session regenerated")
+	// work check
+	if !ok || record.level != GOSESSION_LOG_INFO || record.value("session") != logKey(newId.key(), newId) || record.value("old") != logKey(id.key(), id) {
+		t.Errorf("The regeneration was not logged: %v", record)
+	}
+	newId.destroyS()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: setingsSession.CookieName, Value: "unknown id"})
+	checkUnknownId(r) // calling the tested function
+	record, ok = tl.find("unknown session id")
+	// work check
+	if !ok || record.level != GOSESSION_LOG_DEBUG || record.value("session") == "unknown id" {
+		t.Errorf("The unknown id was not logged or not redacted: %v", record)
+	}
+
+	cleaningSessions() // calling the tested function
+	// work check
+	if _, ok := tl.find("session storage cleaned"); !ok {
+		t.Error("The run of the cleaner was not logged.")
+	}
+}
+
+func Test_logging_errors(t *testing.T) {
+	tl := useTestLogger(t, false)
+	t.Cleanup(ResetHooks)
+	OnCreate(func(event SessionEvent) {
+		panic("hook failure")
+	})
+	startTestSession() // calling the tested function
+	record, ok := tl.find("session hook panicked")
+	// work check
+	if !ok || record.level != GOSESSION_LOG_ERROR || record.value("panic") != "hook failure" || fmt.Sprint(record.value("event")) != "create" {
+		t.Errorf("The panic was not logged: %v", record)
+	}
+
+	useTestStore(t, &failingStore{MemoryStore: NewMemoryStore()})
+	startTestSession() // calling the tested function
+	record, ok = tl.find("session store operation failed")
+	// work check
+	if !ok || record.value("operation") != GOSESSION_STORE_SAVE || fmt.Sprint(record.value("error")) != "disk is full" {
+		t.Errorf("The store error was not logged: %v", record)
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_StdLogger(b *testing.B) {
+	var buf bytes.Buffer
+	sl := NewStdLogger(log.New(&buf, "", 0), GOSESSION_LOG_DEBUG)
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		sl.Log(GOSESSION_LOG_INFO, "session regenerated", "session", "ab12cd34", "old", "ef56ab78") // calling the tested function
+	}
+}
@@ -0,0 +1,302 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	GOSESSION_EXPVAR_NAME string = "gosession" // Default name of the variable published by PublishExpvar()
+
+	GOSESSION_STORE_LOAD   string = "load"   // Store operation Load
+	GOSESSION_STORE_SAVE   string = "save"   // Store operation Save
+	GOSESSION_STORE_DELETE string = "delete" // Store operation Delete
+	GOSESSION_STORE_SCAN   string = "scan"   // Store operation Scan
+)
+
+// The metricsBuckets variable stores the upper bounds of the latency histograms in seconds
+var metricsBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// The storeOperations variable lists the measured operations of the persistent store in the order of the exposition
+var storeOperations = []string{GOSESSION_STORE_LOAD, GOSESSION_STORE_SAVE, GOSESSION_STORE_DELETE, GOSESSION_STORE_SCAN}
+
+// The BucketStats type is a bucket of the histogram, Count is the number of observations less than or equal to UpperBound
+type BucketStats struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// The HistogramStats type describes the distribution of the durations in seconds
+type HistogramStats struct {
+	Count   uint64
+	Sum     float64
+	Buckets []BucketStats // Cumulative buckets without +Inf, which is equal to Count
+}
+
+// The MetricsStats type contains the counters and gauges of the session system
+type MetricsStats struct {
+	Active         int                       // Sessions kept in memory
+	Pending        int                       // Lazy sessions that are not written yet
+	Bytes          int64                     // Approximate memory used by the sessions
+	Created        uint64                    // Sessions created
+	Regenerated    uint64                    // Session ids changed
+	Destroyed      uint64                    // Sessions destroyed by the application or evicted without a persistent store
+	Expired        uint64                    // Expired sessions deleted by the cleaner
+	Changed        uint64                    // Session variables set or removed
+	Evicted        uint64                    // Sessions evicted from memory by the limits
+	Store          map[string]HistogramStats // Latency of the operations of the persistent store
+	StoreErrors    map[string]uint64         // Failed operations of the persistent store
+	Cleaner        HistogramStats            // Duration of the cleaner runs
+	CleanerRemoved uint64                    // Sessions removed by the cleaner from memory and from the persistent store
+}
+
+// The histogram type counts the observations in the buckets of metricsBuckets
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// The newHistogram() function creates an empty histogram
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(metricsBuckets))}
+}
+
+// The observe(seconds) histogram-method adds the observation
+func (h *histogram) observe(seconds float64) {
+	h.mu.Lock()
+	for i, bound := range metricsBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+	h.mu.Unlock()
+}
+
+// The stats() histogram-method returns a copy of the histogram
+func (h *histogram) stats() HistogramStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	buckets := make([]BucketStats, len(metricsBuckets))
+	for i, bound := range metricsBuckets {
+		buckets[i] = BucketStats{UpperBound: bound, Count: h.counts[i]}
+	}
+	return HistogramStats{Count: h.count, Sum: h.sum, Buckets: buckets}
+}
+
+// The metrics of the session system, the counters are changed with the sync/atomic functions
+var (
+	eventCounters  [GOSESSION_EVENT_CHANGE + 1]uint64
+	storeLatency   = make(map[string]*histogram)
+	storeErrors    = make(map[string]*uint64)
+	cleanerLatency = newHistogram()
+	cleanerRemoved uint64
+)
+
+// The init() function creates the histograms and the error counters of the store operations
+func init() {
+	for _, op := range storeOperations {
+		storeLatency[op] = newHistogram()
+		storeErrors[op] = new(uint64)
+	}
+}
+
+// The countEvent(kind) function counts the event of the session, it is called whether there are hooks or not
+func countEvent(kind EventKind) {
+	if kind >= 0 && int(kind) < len(eventCounters) {
+		atomic.AddUint64(&eventCounters[kind], 1)
+	}
+}
+
+// The observeStore(locked, op, key, start, err) function records the duration and the result of the store operation.
+// locked - the block is locked, then the record of the failure is passed to the logger by unlockS().
+func observeStore(locked bool, op string, key string, start time.Time, err error) {
+	storeLatency[op].observe(time.Since(start).Seconds())
+	if err != nil && err != ErrNotFound {
+		atomic.AddUint64(storeErrors[op], 1)
+		log := logS
+		if locked {
+			log = logLocked
+		}
+		log(GOSESSION_LOG_ERROR, "session store operation failed", "operation", op, "session", logKey(SessionId(key), ""), "error", err)
+	}
+}
+
+// The callStore(locked, op, key, call) function calls the operation of the store, measures and traces it.
+// locked - the block is locked, then the span and the log record are reported by unlockS().
+func callStore(locked bool, op string, key string, call func() error) error {
+	span := traceStore(locked, op, key)
+	start := time.Now()
+	err := call()
+	observeStore(locked, op, key, start, err)
+	endStoreSpan(span, err)
+	return err
+}
+
+// The storeLoad(store, key) function calls Load of the store, measures and traces it, the block must not be locked
+func storeLoad(store Store, key string) ([]byte, error) {
+	var b []byte
+	err := callStore(false, GOSESSION_STORE_LOAD, key, func() (err error) {
+		b, err = store.Load(key)
+		return err
+	})
+	return b, err
+}
+
+// The storeLoadLocked(store, key) function calls Load of the store, measures and traces it, the block must be locked
+func storeLoadLocked(store Store, key string) ([]byte, error) {
+	var b []byte
+	err := callStore(true, GOSESSION_STORE_LOAD, key, func() (err error) {
+		b, err = store.Load(key)
+		return err
+	})
+	return b, err
+}
+
+// The storeSaveLocked(store, key, data, expiration) function calls Save of the store, measures and traces it, the block must be locked
+func storeSaveLocked(store Store, key string, data []byte, expiration int64) error {
+	return callStore(true, GOSESSION_STORE_SAVE, key, func() error {
+		return store.Save(key, data, expiration)
+	})
+}
+
+// The storeDeleteLocked(store, key) function calls Delete of the store, measures and traces it, the block must be locked
+func storeDeleteLocked(store Store, key string) error {
+	return callStore(true, GOSESSION_STORE_DELETE, key, func() error {
+		return store.Delete(key)
+	})
+}
+
+// The storeScan(store, cursor, limit) function calls Scan of the store, measures and traces it, the block must not be locked
+func storeScan(store Store, cursor string, limit int) ([]string, string, error) {
+	var keys []string
+	next := ""
+	err := callStore(false, GOSESSION_STORE_SCAN, "", func() (err error) {
+		keys, next, err = store.Scan(cursor, limit)
+		return err
+	})
+	return keys, next, err
+}
+
+// The observeCleaner(start, removed) function records the run of the cleaner
+func observeCleaner(start time.Time, removed int) {
+	duration := time.Since(start)
+	cleanerLatency.observe(duration.Seconds())
+	atomic.AddUint64(&cleanerRemoved, uint64(removed))
+	logS(GOSESSION_LOG_DEBUG, "session storage cleaned", "removed", removed, "duration", duration)
+}
+
+// The Metrics() function returns the current counters and gauges of the session system
+func Metrics() MetricsStats {
+	block.RLock()
+	active := len(allSessions)
+	pending := len(pendingSessions)
+	bytes := memoryBytes
+	evicted := evictions
+	block.RUnlock()
+
+	ms := MetricsStats{
+		Active:         active,
+		Pending:        pending,
+		Bytes:          bytes,
+		Created:        atomic.LoadUint64(&eventCounters[GOSESSION_EVENT_CREATE]),
+		Regenerated:    atomic.LoadUint64(&eventCounters[GOSESSION_EVENT_REGENERATE]),
+		Destroyed:      atomic.LoadUint64(&eventCounters[GOSESSION_EVENT_DESTROY]),
+		Expired:        atomic.LoadUint64(&eventCounters[GOSESSION_EVENT_EXPIRE]),
+		Changed:        atomic.LoadUint64(&eventCounters[GOSESSION_EVENT_CHANGE]),
+		Evicted:        evicted,
+		Store:          make(map[string]HistogramStats, len(storeOperations)),
+		StoreErrors:    make(map[string]uint64, len(storeOperations)),
+		Cleaner:        cleanerLatency.stats(),
+		CleanerRemoved: atomic.LoadUint64(&cleanerRemoved),
+	}
+	for _, op := range storeOperations {
+		ms.Store[op] = storeLatency[op].stats()
+		ms.StoreErrors[op] = atomic.LoadUint64(storeErrors[op])
+	}
+	return ms
+}
+
+// The PublishExpvar(name) function publishes the metrics as the expvar variable, they are shown by the /debug/vars handler.
+// name - name of the variable, GOSESSION_EXPVAR_NAME if empty. Like expvar.Publish(), it panics if the name is already used.
+func PublishExpvar(name string) {
+	if name == "" {
+		name = GOSESSION_EXPVAR_NAME
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return Metrics()
+	}))
+}
+
+// The formatFloat(v) function formats the number for the Prometheus text format
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// The writeHistogram(bw, name, labels, hs) function writes the histogram in the Prometheus text format.
+// labels - labels of the series with a trailing comma, or empty.
+func writeHistogram(bw *bufio.Writer, name string, labels string, hs HistogramStats) {
+	for _, bucket := range hs.Buckets {
+		fmt.Fprintf(bw, "%s_bucket{%sle=\"%s\"} %d\n", name, labels, formatFloat(bucket.UpperBound), bucket.Count)
+	}
+	fmt.Fprintf(bw, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, hs.Count)
+	if labels != "" {
+		labels = "{" + labels[:len(labels)-1] + "}"
+	}
+	fmt.Fprintf(bw, "%s_sum%s %s\n", name, labels, formatFloat(hs.Sum))
+	fmt.Fprintf(bw, "%s_count%s %d\n", name, labels, hs.Count)
+}
+
+// The writeMetric(bw, name, kind, help, value) function writes the metric without labels in the Prometheus text format
+func writeMetric(bw *bufio.Writer, name string, kind string, help string, value interface{}) {
+	fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
+
+// The MetricsHandler() function returns the http.Handler that shows the metrics in the Prometheus text format,
+// so they can be collected without third-party libraries
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms := Metrics()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		writeMetric(bw, "gosession_sessions_active", "gauge", "Sessions kept in memory.", ms.Active)
+		writeMetric(bw, "gosession_sessions_pending", "gauge", "Lazy sessions that are not written yet.", ms.Pending)
+		writeMetric(bw, "gosession_sessions_bytes", "gauge", "Approximate memory used by the sessions.", ms.Bytes)
+		writeMetric(bw, "gosession_sessions_created_total", "counter", "Sessions created.", ms.Created)
+		writeMetric(bw, "gosession_sessions_regenerated_total", "counter", "Session ids changed.", ms.Regenerated)
+		writeMetric(bw, "gosession_sessions_destroyed_total", "counter", "Sessions destroyed.", ms.Destroyed)
+		writeMetric(bw, "gosession_sessions_expired_total", "counter", "Expired sessions deleted by the cleaner.", ms.Expired)
+		writeMetric(bw, "gosession_sessions_changed_total", "counter", "Session variables set or removed.", ms.Changed)
+		writeMetric(bw, "gosession_sessions_evicted_total", "counter", "Sessions evicted from memory by the limits.", ms.Evicted)
+
+		fmt.Fprint(bw, "# HELP gosession_store_operation_duration_seconds Latency of the operations of the persistent store.\n")
+		fmt.Fprint(bw, "# TYPE gosession_store_operation_duration_seconds histogram\n")
+		for _, op := range storeOperations {
+			writeHistogram(bw, "gosession_store_operation_duration_seconds", "operation=\""+op+"\",", ms.Store[op])
+		}
+		fmt.Fprint(bw, "# HELP gosession_store_errors_total Failed operations of the persistent store.\n")
+		fmt.Fprint(bw, "# TYPE gosession_store_errors_total counter\n")
+		for _, op := range storeOperations {
+			fmt.Fprintf(bw, "gosession_store_errors_total{operation=\"%s\"} %d\n", op, ms.StoreErrors[op])
+		}
+
+		fmt.Fprint(bw, "# HELP gosession_cleaner_duration_seconds Duration of the cleaner runs.\n")
+		fmt.Fprint(bw, "# TYPE gosession_cleaner_duration_seconds histogram\n")
+		writeHistogram(bw, "gosession_cleaner_duration_seconds", "", ms.Cleaner)
+		writeMetric(bw, "gosession_cleaner_removed_total", "counter", "Sessions removed by the cleaner.", ms.CleanerRemoved)
+		bw.Flush()
+	})
+}
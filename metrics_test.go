@@ -0,0 +1,165 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// --------------
+// Test functions
+// --------------
+
+func Test_histogram(t *testing.T) {
+	h := newHistogram()
+	h.observe(0.0002) // calling the tested function
+	h.observe(0.2)    // calling the tested function
+	h.observe(60)     // calling the tested function
+	hs := h.stats()
+	// work check
+	if hs.Count != 3 || hs.Sum < 60.2 || hs.Sum > 60.3 {
+		t.Errorf("Incorrect count or sum: %v", hs)
+	}
+	for _, bucket := range hs.Buckets {
+		var want uint64
+		switch {
+		case bucket.UpperBound >= 0.5:
+			want = 2
+		case bucket.UpperBound >= 0.0005:
+			want = 1
+		}
+		// work check
+		if bucket.Count != want {
+			t.Errorf("Bucket %v has %v observations, want %v.", bucket.UpperBound, bucket.Count, want)
+		}
+	}
+}
+
+func Test_Metrics(t *testing.T) {
+	before := Metrics()
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		id := startTestSession()
+		id.Set("name", "value")
+		var w http.ResponseWriter = httptest.NewRecorder()
+		id.Destroy(&w)
+	}
+	after := Metrics() // calling the tested function
+	// work check
+	if after.Created-before.Created < uint64(GOSESSION_TESTING_ITER) || after.Destroyed-before.Destroyed < uint64(GOSESSION_TESTING_ITER) {
+		t.Errorf("The sessions were not counted: %v created, %v destroyed", after.Created-before.Created, after.Destroyed-before.Destroyed)
+	}
+	// work check
+	if after.Changed-before.Changed < uint64(GOSESSION_TESTING_ITER) {
+		t.Error("The changes were not counted.")
+	}
+	// work check
+	if after.Active != Capacity().Sessions {
+		t.Errorf("Incorrect number of active sessions: %v", after.Active)
+	}
+}
+
+func Test_Metrics_store(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+	before := Metrics()
+
+	id := startTestSession()
+	id.Set("name", "value")
+	restartMemory([]SessionId{id})
+	id.Get("name")
+	var w http.ResponseWriter = httptest.NewRecorder()
+	id.Destroy(&w)
+
+	after := Metrics() // calling the tested function
+	for _, op := range []string{GOSESSION_STORE_SAVE, GOSESSION_STORE_LOAD, GOSESSION_STORE_DELETE} {
+		// work check
+		if after.Store[op].Count <= before.Store[op].Count {
+			t.Errorf("The store operation %q was not measured.", op)
+		}
+	}
+}
+
+func Test_Metrics_cleaner(t *testing.T) {
+	id := startTestSession()
+	block.Lock()
+	ses := allSessions[id.key()]
+	ses.expiration = time.Now().Unix() - 1
+	allSessions[id.key()] = ses
+	block.Unlock()
+	before := Metrics()
+
+	cleaningSessions() // calling the tested function
+	after := Metrics()
+	// work check
+	if after.Cleaner.Count != before.Cleaner.Count+1 {
+		t.Error("The run of the cleaner was not measured.")
+	}
+	// work check
+	if after.CleanerRemoved-before.CleanerRemoved < 1 || after.Expired-before.Expired < 1 {
+		t.Error("The expired session was not counted.")
+	}
+}
+
+func Test_MetricsHandler(t *testing.T) {
+	startTestSession()
+	w := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil)) // calling the tested function
+	body := w.Body.String()
+	// work check
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Incorrect content type: %v", w.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"# TYPE gosession_sessions_active gauge\n",
+		"# TYPE gosession_sessions_created_total counter\n",
+		"gosession_store_operation_duration_seconds_bucket{operation=\"load\",le=\"0.001\"} ",
+		"gosession_store_operation_duration_seconds_bucket{operation=\"scan\",le=\"+Inf\"} ",
+		"gosession_store_operation_duration_seconds_count{operation=\"save\"} ",
+		"gosession_cleaner_duration_seconds_sum ",
+		"gosession_cleaner_removed_total ",
+	} {
+		// work check
+		if !strings.Contains(body, line) {
+			t.Errorf("The exposition does not contain %q.", line)
+		}
+	}
+}
+
+func Test_PublishExpvar(t *testing.T) {
+	PublishExpvar("gosession_test") // calling the tested function
+	v := expvar.Get("gosession_test")
+	// work check
+	if v == nil {
+		t.Fatal("The variable was not published.")
+	}
+	var ms MetricsStats
+	// work check
+	if err := json.Unmarshal([]byte(v.String()), &ms); err != nil || len(ms.Store) != len(storeOperations) {
+		t.Errorf("Incorrect value of the variable: %v", err)
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_Metrics(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Metrics() // calling the tested function
+	}
+}
+
+func Benchmark_observeStore(b *testing.B) {
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		observeStore(false, GOSESSION_STORE_LOAD, "key", start, nil) // calling the tested function
+	}
+}
@@ -0,0 +1,145 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"sync/atomic"
+)
+
+// The MigratingStore type is the Store for moving sessions from the old store to the new one without logging users out.
+// Sessions are read from the new store, falling back to the old one, and the sessions found only in the old store are copied on access.
+// Changes are written to the new store and, with dual write, also to the old one, so it is possible to switch back.
+type MigratingStore struct {
+	from      Store
+	to        Store
+	dualWrite bool
+	copied    int64
+}
+
+// The CopyResult type describes the result of CopyStore()
+type CopyResult struct {
+	Copied  int // Sessions written to the destination
+	Skipped int // Entries that disappeared, expired or could not be decoded
+}
+
+// The NewMigratingStore(from, to, dualWrite) function creates the store that migrates the sessions.
+// from - the old store.
+// to - the new store.
+// dualWrite - write the changes to both stores.
+func NewMigratingStore(from Store, to Store, dualWrite bool) *MigratingStore {
+	return &MigratingStore{from: from, to: to, dualWrite: dualWrite}
+}
+
+// The Load(key) MigratingStore-method reads the session from the new store or copies it from the old one
+func (ms *MigratingStore) Load(key string) ([]byte, error) {
+	b, err := ms.to.Load(key)
+	if err != ErrNotFound {
+		return b, err
+	}
+	b, err = ms.from.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	if ses, err := decodeSession(b); err == nil {
+		if err := ms.to.Save(key, b, ses.expiration); err == nil {
+			atomic.AddInt64(&ms.copied, 1)
+		}
+	}
+	return b, nil
+}
+
+// The Save(key, data, expiration) MigratingStore-method writes the session to the new store and, with dual write, to the old one
+func (ms *MigratingStore) Save(key string, data []byte, expiration int64) error {
+	if err := ms.to.Save(key, data, expiration); err != nil {
+		return err
+	}
+	if ms.dualWrite {
+		return ms.from.Save(key, data, expiration)
+	}
+	return nil
+}
+
+// The Delete(key) MigratingStore-method removes the session from both stores, so that it does not come back from the old one
+func (ms *MigratingStore) Delete(key string) error {
+	errTo := ms.to.Delete(key)
+	if err := ms.from.Delete(key); err != nil {
+		return err
+	}
+	return errTo
+}
+
+// The Scan(cursor, limit) MigratingStore-method returns the keys of both stores in sorted order starting after the cursor
+func (ms *MigratingStore) Scan(cursor string, limit int) ([]string, string, error) {
+	toKeys, toNext, err := ms.to.Scan(cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	fromKeys, fromNext, err := ms.from.Scan(cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	keys, next := mergeScan(toKeys, toNext, fromKeys, fromNext, limit)
+	return keys, next, nil
+}
+
+// The Copied() MigratingStore-method returns the number of sessions copied from the old store on access
+func (ms *MigratingStore) Copied() int64 {
+	return atomic.LoadInt64(&ms.copied)
+}
+
+// The CopyStore(from, to) function copies all live sessions from one store to another preserving their expiration,
+// reading the source page by page. Existing sessions in the destination are overwritten.
+// from - the source store.
+// to - the destination store.
+func CopyStore(from Store, to Store) (CopyResult, error) {
+	var res CopyResult
+	cursor := ""
+	for {
+		keys, next, err := from.Scan(cursor, GOSESSION_SCAN_PAGE)
+		if err != nil {
+			return res, err
+		}
+		presently := clockNow().Unix()
+		for _, key := range keys {
+			b, err := from.Load(key)
+			if err == ErrNotFound {
+				res.Skipped++
+				continue
+			}
+			if err != nil {
+				return res, err
+			}
+			ses, err := decodeSession(b)
+			if err != nil || ses.expiration < presently {
+				res.Skipped++
+				continue
+			}
+			if err := to.Save(key, b, ses.expiration); err != nil {
+				return res, err
+			}
+			res.Copied++
+		}
+		if next == "" {
+			return res, nil
+		}
+		cursor = next
+	}
+}
+
+// The PersistAll() function writes all sessions kept in memory to the store from the settings and returns their number.
+// Call it after setting the first persistent store, so that the sessions created before keep living after a restart.
+func PersistAll() int {
+	if setingsSession.Store == nil {
+		return 0
+	}
+	count := 0
+	block.Lock()
+	for key, ses := range allSessions {
+		saveStoreLocked(key, ses)
+		count++
+	}
+	unlockS()
+	return count
+}
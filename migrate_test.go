@@ -0,0 +1,157 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// The encodedTestSession(expiration, name, value) function returns the serialized session with one variable
+func encodedTestSession(expiration int64, name string, value interface{}) []byte {
+	b, _ := encodeSession(internalSession{expiration: expiration, data: Session{name: value}})
+	return b
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_MigratingStore(t *testing.T) {
+	from := NewMemoryStore()
+	to := NewMemoryStore()
+	future := time.Now().Unix() + 60
+	from.Save("old", encodedTestSession(future, "name", "old"), future)
+	ms := NewMigratingStore(from, to, false)
+
+	b, err := ms.Load("old") // calling the tested function
+	// work check
+	if err != nil || b == nil {
+		t.Fatalf("The session was not read from the old store: %v", err)
+	}
+	// work check
+	if _, err := to.Load("old"); err != nil || ms.Copied() != 1 {
+		t.Error("The session was not copied on access.")
+	}
+	// work check
+	if _, err := ms.Load("missing"); err != ErrNotFound { // calling the tested function
+		t.Error("A missing session was loaded.")
+	}
+
+	ms.Save("new", encodedTestSession(future, "name", "new"), future) // calling the tested function
+	// work check
+	if _, err := from.Load("new"); err != ErrNotFound {
+		t.Error("The session was written to the old store without dual write.")
+	}
+	NewMigratingStore(from, to, true).Save("dual", encodedTestSession(future, "name", "dual"), future) // calling the tested function
+	// work check
+	if _, err := from.Load("dual"); err != nil {
+		t.Error("The session was not written to the old store with dual write.")
+	}
+
+	ms.Delete("old") // calling the tested function
+	// work check
+	if _, err := ms.Load("old"); err != ErrNotFound {
+		t.Error("The deleted session came back from the old store.")
+	}
+}
+
+func Test_MigratingStore_Scan(t *testing.T) {
+	from := NewMemoryStore()
+	to := NewMemoryStore()
+	future := time.Now().Unix() + 60
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		key := fmt.Sprintf("key%03d", i)
+		switch i % 3 {
+		case 0:
+			from.Save(key, nil, future)
+		case 1:
+			to.Save(key, nil, future)
+		default:
+			from.Save(key, nil, future)
+			to.Save(key, nil, future)
+		}
+	}
+	ms := NewMigratingStore(from, to, false)
+
+	seen := make(map[string]int)
+	cursor := ""
+	for {
+		keys, next, err := ms.Scan(cursor, 7) // calling the tested function
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range keys {
+			seen[key]++
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	// work check
+	if len(seen) != GOSESSION_TESTING_ITER {
+		t.Errorf("Scan returned %v keys.", len(seen))
+	}
+	for key, n := range seen {
+		// work check
+		if n != 1 {
+			t.Errorf("The key %v was returned %v times.", key, n)
+		}
+	}
+}
+
+func Test_CopyStore(t *testing.T) {
+	from := NewMemoryStore()
+	to := NewMemoryStore()
+	future := time.Now().Unix() + 60
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		from.Save(fmt.Sprintf("key%03d", i), encodedTestSession(future+int64(i), "n", i), future+int64(i))
+	}
+	from.Save("damaged", []byte("bad data"), future)
+
+	res, err := CopyStore(from, to) // calling the tested function
+	// work check
+	if err != nil || res.Copied != GOSESSION_TESTING_ITER || res.Skipped != 1 {
+		t.Fatalf("Incorrect result: %+v %v", res, err)
+	}
+	to.mu.RLock()
+	e := to.entries["key042"]
+	to.mu.RUnlock()
+	// work check
+	if e.expiration != future+42 {
+		t.Error("The expiration was not preserved.")
+	}
+}
+
+func Test_PersistAll(t *testing.T) {
+	id := startTestSession()
+	id.Set("name", "value")
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+
+	PersistAll() // calling the tested function
+	// work check
+	if _, err := ms.Load(string(id.key())); err != nil {
+		t.Error("The session kept in memory was not written to the store.")
+	}
+	id.destroyS()
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_MigratingStore_Load(b *testing.B) {
+	from := NewMemoryStore()
+	future := time.Now().Unix() + 60
+	data := encodedTestSession(future, "name", "value")
+	for i := 0; i < b.N; i++ {
+		key := fmt.Sprintf("key%d", i)
+		from.Save(key, data, future)
+		NewMigratingStore(from, NewMemoryStore(), false).Load(key) // calling the tested function
+	}
+}
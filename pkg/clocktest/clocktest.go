@@ -0,0 +1,114 @@
+// This package provides a fake clock for testing code that uses GoSession.
+// The time of the fake clock stands still until Advance() is called, which fires the due timers,
+// so the expiration of sessions and the cleaner can be driven deterministically without sleeping.
+package clocktest
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Kwynto/gosession"
+)
+
+// The Clock type is the fake gosession.Clock
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers []*timer
+}
+
+// The timer type is the timer of the fake clock
+type timer struct {
+	clock *Clock
+	when  time.Time
+	seq   uint64 // Order of creation, the timers with the same time fire in this order
+	f     func()
+}
+
+// The New(start) function creates the fake clock that shows the start time.
+// start - the initial time of the clock.
+func New(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// The Now() Clock-method returns the current time of the clock
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// The AfterFunc(d, f) Clock-method creates the timer that calls f when the clock is advanced by d or more.
+// Unlike time.AfterFunc(), f is called in the goroutine that calls Advance().
+func (c *Clock) AfterFunc(d time.Duration, f func()) gosession.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &timer{clock: c, when: c.now.Add(d), seq: c.seq, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// The Advance(d) Clock-method moves the clock forward by d and calls the functions of the due timers in order of their time.
+// The timers created by these functions also fire if they are due before the new time.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		t := c.nextLocked(target)
+		if t == nil {
+			break
+		}
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+// The Pending() Clock-method returns the number of timers that have not fired and are not stopped
+func (c *Clock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// The nextLocked(target) Clock-method removes and returns the earliest timer due by the target time, the mutex must be locked
+func (c *Clock) nextLocked(target time.Time) *timer {
+	sort.Slice(c.timers, func(i, j int) bool {
+		if c.timers[i].when.Equal(c.timers[j].when) {
+			return c.timers[i].seq < c.timers[j].seq
+		}
+		return c.timers[i].when.Before(c.timers[j].when)
+	})
+	if len(c.timers) == 0 || c.timers[0].when.After(target) {
+		return nil
+	}
+	t := c.timers[0]
+	c.timers = c.timers[1:]
+	return t
+}
+
+// The Stop() timer-method prevents the timer from firing and reports whether it was pending
+func (t *timer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
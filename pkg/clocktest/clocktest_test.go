@@ -0,0 +1,137 @@
+package clocktest
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kwynto/gosession"
+)
+
+// The testStart value is the initial time of the clocks in the tests
+var testStart = time.Unix(1_700_000_000, 0)
+
+// The useClock(t, clock) function sets the clock, the expiration of 1 minute and the cleaning every minute,
+// and restores the default settings after the test
+func useClock(t *testing.T, clock *Clock) {
+	gosession.SetSetings(gosession.GoSessionSetings{
+		CookieName:    gosession.GOSESSION_COOKIE_NAME,
+		Expiration:    60,
+		TimerCleaning: time.Minute,
+		Clock:         clock,
+	})
+	t.Cleanup(func() {
+		gosession.SetSetings(gosession.GoSessionSetings{
+			CookieName:    gosession.GOSESSION_COOKIE_NAME,
+			Expiration:    gosession.GOSESSION_EXPIRATION,
+			TimerCleaning: gosession.GOSESSION_TIMER_FOR_CLEANING,
+		})
+	})
+}
+
+// The startSession() function starts a new session
+func startSession() gosession.SessionId {
+	var id gosession.SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = gosession.Start(&w, r)
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	return id
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_Advance(t *testing.T) {
+	clock := New(testStart)
+	fired := make([]int, 0)
+	clock.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+	clock.AfterFunc(time.Second, func() {
+		fired = append(fired, 1)
+		clock.AfterFunc(time.Second, func() { fired = append(fired, 3) })
+	})
+	stopped := clock.AfterFunc(time.Second, func() { fired = append(fired, 0) })
+	// work check
+	if !stopped.Stop() || stopped.Stop() { // calling the tested function
+		t.Error("Incorrect result of Stop().")
+	}
+
+	clock.Advance(1500 * time.Millisecond) // calling the tested function
+	// work check
+	if len(fired) != 1 || !clock.Now().Equal(testStart.Add(1500*time.Millisecond)) {
+		t.Errorf("Incorrect state: %v %v", fired, clock.Now())
+	}
+	clock.Advance(time.Second) // calling the tested function
+	// work check
+	if len(fired) != 3 || fired[1] != 2 || fired[2] != 3 || clock.Pending() != 0 {
+		t.Errorf("The timers fired in the wrong order: %v", fired)
+	}
+}
+
+func Test_expiration(t *testing.T) {
+	clock := New(testStart)
+	useClock(t, clock)
+	id := startSession()
+	id.Set("name", "value")
+	id.SetWithTTL("code", 1234, 10*time.Second)
+	info, _ := id.Info()
+	// work check
+	if !info.Expiration.Equal(testStart.Add(time.Minute)) {
+		t.Errorf("Incorrect expiration: %v", info.Expiration)
+	}
+
+	clock.Advance(11 * time.Second) // calling the tested function
+	// work check
+	if id.Get("code") != nil || id.Get("name") != "value" {
+		t.Error("Incorrect variables after 11 seconds.")
+	}
+
+	clock.Advance(2 * time.Minute) // calling the tested function
+	// work check
+	if id.GetAll() != nil {
+		t.Error("The expired session was not removed by the cleaner.")
+	}
+}
+
+func Test_Close(t *testing.T) {
+	t.Cleanup(gosession.Open)
+	clock := New(testStart)
+	useClock(t, clock)
+	// work check
+	if clock.Pending() != 1 {
+		t.Fatalf("The cleaner is not scheduled: %v", clock.Pending())
+	}
+
+	gosession.Close() // calling the tested function
+	start := gosession.Metrics().Cleaner.Count
+	clock.Advance(time.Hour)
+	// work check
+	if clock.Pending() != 0 || gosession.Metrics().Cleaner.Count != start {
+		t.Errorf("The cleaner runs after Close(): %v timers, %v runs", clock.Pending(), gosession.Metrics().Cleaner.Count-start)
+	}
+
+	gosession.Open() // calling the tested function
+	clock.Advance(time.Minute)
+	// work check
+	if clock.Pending() != 1 || gosession.Metrics().Cleaner.Count != start+1 {
+		t.Errorf("The cleaner is not scheduled after Open(): %v timers, %v runs", clock.Pending(), gosession.Metrics().Cleaner.Count-start)
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_Advance(b *testing.B) {
+	clock := New(testStart)
+	for i := 0; i < b.N; i++ {
+		clock.AfterFunc(time.Second, func() {})
+		clock.Advance(time.Second) // calling the tested function
+	}
+}
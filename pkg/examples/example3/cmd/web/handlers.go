@@ -39,9 +39,11 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		tD.Cart = prods
 	}
 
-	username := id.Get("username")
-	if username != nil {
-		tD.User = fmt.Sprint(username)
+	tD.CSRFField = id.CSRFField()
+	tD.Flashes = id.Flashes()
+
+	if id.IsAuthenticated() {
+		tD.User = id.UserId()
 		app.render(w, r, "homeauth.page.tmpl", tD)
 	} else {
 		app.render(w, r, "home.page.tmpl", tD)
@@ -61,9 +63,13 @@ func (app *application) authPage(w http.ResponseWriter, r *http.Request) {
 	id := gosession.StartSecure(&w, r)
 
 	if username != "" && password != "" {
-		pasHash := app.getMd5(password)
-		id.Set("username", username)
-		id.Set("hash", pasHash)
+		var err error
+		id, err = id.Login(&w, username)
+		if err != nil {
+			id.AddFlash(gosession.GOSESSION_FLASH_ERROR, "Too many sessions")
+		} else {
+			id.AddFlash(gosession.GOSESSION_FLASH_SUCCESS, "Logged in")
+		}
 	}
 
 	transitions := id.Get("transitions")
@@ -78,7 +84,8 @@ func (app *application) authPage(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) outPage(w http.ResponseWriter, r *http.Request) {
 	id := gosession.StartSecure(&w, r)
-	id.Remove("username")
+	id = id.Logout(&w)
+	id.AddFlash(gosession.GOSESSION_FLASH_INFO, "Logged out")
 
 	transitions := id.Get("transitions")
 	if transitions == nil {
@@ -91,8 +98,6 @@ func (app *application) outPage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) buyPage(w http.ResponseWriter, r *http.Request) {
-	tD := &templateData{User: "", Hash: "", Cart: []string{""}, Transitions: []string{""}}
-
 	id := gosession.StartSecure(&w, r)
 
 	transitions := id.Get("transitions")
@@ -101,9 +106,6 @@ func (app *application) buyPage(w http.ResponseWriter, r *http.Request) {
 	}
 	transitions = fmt.Sprint(transitions, " ", r.RequestURI)
 	id.Set("transitions", transitions)
-	tStr := fmt.Sprintf("%v", transitions)
-	tStrs := strings.Split(tStr, " ")
-	tD.Transitions = tStrs
 
 	cart := id.Get("cart")
 	if cart == nil {
@@ -111,14 +113,8 @@ func (app *application) buyPage(w http.ResponseWriter, r *http.Request) {
 	}
 	sCart := app.addProduct(fmt.Sprint(cart), app.convertProduct(r.RequestURI))
 	id.Set("cart", sCart)
-	prods := strings.Split(sCart, " ")
-	tD.Cart = prods
 
-	username := id.Get("username")
-	if username != nil {
-		tD.User = fmt.Sprint(username)
-		app.render(w, r, "homeauth.page.tmpl", tD)
-	} else {
-		app.render(w, r, "home.page.tmpl", tD)
-	}
+	// The message is shown once on the next page, after the redirect
+	id.AddFlash(gosession.GOSESSION_FLASH_SUCCESS, "Item added")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -1,8 +1,6 @@
 package main
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
 	"net/http"
 	"runtime/debug"
@@ -10,12 +8,6 @@ import (
 	"strings"
 )
 
-func (app *application) getMd5(text string) string {
-	h := md5.New()
-	h.Write([]byte(text))
-	return hex.EncodeToString(h.Sum(nil))
-}
-
 func (app *application) convertProduct(uri string) string {
 	res := strings.Trim(uri, "/")
 	res = strings.ToUpper(res)
@@ -3,6 +3,8 @@ package main
 import (
 	"net/http"
 	"path/filepath"
+
+	"github.com/Kwynto/gosession"
 )
 
 type neuteredFileSystem struct {
@@ -32,7 +34,7 @@ func (nfs neuteredFileSystem) Open(path string) (http.File, error) {
 	return f, nil
 }
 
-func (app *application) routes() *http.ServeMux {
+func (app *application) routes() http.Handler {
 	// Routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", app.home)
@@ -46,5 +48,6 @@ func (app *application) routes() *http.ServeMux {
 	mux.Handle("/static", http.NotFoundHandler())
 	mux.Handle("/static/", http.StripPrefix("/static", fileServer))
 
-	return mux
+	// Checking the CSRF token of all POST requests
+	return gosession.CSRFProtect(mux)
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"html/template"
 	"path/filepath"
+
+	"github.com/Kwynto/gosession"
 )
 
 // Structure for the data template
@@ -11,6 +13,8 @@ type templateData struct {
 	Hash        string
 	Cart        []string
 	Transitions []string
+	CSRFField   template.HTML
+	Flashes     gosession.FlashList
 }
 
 func newTemplateCache(dir string) (map[string]*template.Template, error) {
@@ -3,3 +3,5 @@ module example3
 go 1.17
 
 require github.com/Kwynto/gosession v0.2.4
+
+replace github.com/Kwynto/gosession => ../../../
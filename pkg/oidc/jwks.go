@@ -0,0 +1,179 @@
+package oidc
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"sync"
+)
+
+// The errors returned when the keys are parsed
+var (
+	ErrUnsupportedKey = errors.New("oidc: only RSA keys and EC keys on the P-256 curve are supported")
+	ErrInvalidJWKS    = errors.New("oidc: invalid JSON Web Key Set")
+)
+
+// The jsonWebKey type is one key of the JSON Web Key Set, RFC 7517
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// The verificationKey type is a public key of the identity provider
+type verificationKey struct {
+	kid string
+	alg string // Algorithm allowed for the key, empty - any algorithm of its type
+	key crypto.PublicKey
+}
+
+// The KeySet type contains the public keys used to verify the tokens of the identity provider
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []verificationKey
+}
+
+// The NewKeySet() function creates an empty key set, the keys are added with the Add() method
+func NewKeySet() *KeySet {
+	return &KeySet{}
+}
+
+// The ParseKeySet(data) function creates a key set from the JSON Web Key Set.
+// The encryption keys and the keys of unsupported types are skipped.
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, ErrInvalidJWKS
+	}
+	ks := NewKeySet()
+	for _, jwk := range jwks.Keys {
+		if jwk.Use == "enc" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err == ErrUnsupportedKey {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ks.keys = append(ks.keys, verificationKey{kid: jwk.Kid, alg: jwk.Alg, key: key})
+	}
+	return ks, nil
+}
+
+// The LoadKeySet(path) function creates a key set from the JSON Web Key Set file
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeySet(data)
+}
+
+// The decodeInt(s) function decodes a base64url big-endian integer of the key
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, ErrInvalidJWKS
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// The publicKey() jsonWebKey-method converts the key into the public key
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(jwk.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, ErrInvalidJWKS
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, ErrUnsupportedKey
+		}
+		x, err := decodeInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, ErrInvalidJWKS
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// The Add(kid, key) KeySet-method adds the public key to the key set.
+// kid - key identifier from the header of the tokens, empty - the key is tried for tokens without the identifier.
+// key - *rsa.PublicKey or *ecdsa.PublicKey on the P-256 curve.
+func (ks *KeySet) Add(kid string, key crypto.PublicKey) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return ErrUnsupportedKey
+		}
+	default:
+		return ErrUnsupportedKey
+	}
+	ks.mu.Lock()
+	ks.keys = append(ks.keys, verificationKey{kid: kid, key: key})
+	ks.mu.Unlock()
+	return nil
+}
+
+// The candidates(kid, alg) KeySet-method returns the keys that can verify the token with the identifier and the algorithm
+func (ks *KeySet) candidates(kid string, alg string) []crypto.PublicKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	res := make([]crypto.PublicKey, 0, 1)
+	for _, vk := range ks.keys {
+		if kid != "" && vk.kid != kid {
+			continue
+		}
+		if vk.alg != "" && vk.alg != alg {
+			continue
+		}
+		switch vk.key.(type) {
+		case *rsa.PublicKey:
+			if alg != "RS256" {
+				continue
+			}
+		case *ecdsa.PublicKey:
+			if alg != "ES256" {
+				continue
+			}
+		}
+		res = append(res, vk.key)
+	}
+	return res
+}
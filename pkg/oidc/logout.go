@@ -0,0 +1,273 @@
+package oidc
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kwynto/gosession"
+)
+
+const (
+	GOSESSION_OIDC_LINK_SID       string        = "oidc.sid"                                           // Kind of the session link to the session of the provider
+	GOSESSION_OIDC_LINK_SUB       string        = "oidc.sub"                                           // Kind of the session link to the user of the provider
+	GOSESSION_OIDC_LOGOUT_EVENT   string        = "http://schemas.openid.net/event/backchannel-logout" // Event of the logout token
+	GOSESSION_OIDC_LOGOUT_MAX_AGE time.Duration = 5 * time.Minute                                      // Max age of the logout token
+	GOSESSION_OIDC_CLOCK_SKEW     time.Duration = time.Minute                                          // Allowed difference of the clocks of the provider and the server
+)
+
+// The errors returned by the verification of the logout token
+var (
+	ErrInvalidToken     = errors.New("oidc: malformed token")
+	ErrUnsupportedAlg   = errors.New("oidc: the token must be signed with RS256 or ES256")
+	ErrInvalidSignature = errors.New("oidc: invalid token signature")
+	ErrInvalidClaims    = errors.New("oidc: invalid logout token claims")
+	ErrTokenReplayed    = errors.New("oidc: the logout token was already used")
+)
+
+// The LogoutSetings type describes the settings of the back-channel logout receiver
+type LogoutSetings struct {
+	Issuer   string                                 // Issuer of the tokens, the "iss" claim
+	ClientId string                                 // Client identifier of the application, it must be in the "aud" claim
+	Keys     *KeySet                                // Public keys of the provider
+	MaxAge   time.Duration                          // Max age of the logout token, GOSESSION_OIDC_LOGOUT_MAX_AGE if zero
+	OnLogout func(token LogoutToken, destroyed int) // Called after the sessions are destroyed
+}
+
+// The LogoutToken type contains the verified claims of the logout token
+type LogoutToken struct {
+	Issuer    string
+	Subject   string
+	SessionId string // The "sid" claim, session of the provider
+	Audience  []string
+	IssuedAt  time.Time
+	JTI       string
+}
+
+// The LogoutHandler type is the http.Handler that receives the back-channel logout requests of the provider
+type LogoutHandler struct {
+	setings LogoutSetings
+	mu      sync.Mutex
+	seen    map[string]time.Time // Identifiers of the used tokens until they become too old
+}
+
+// The audience type is the "aud" claim, which is a string or an array of strings
+type audience []string
+
+// The logoutClaims type is the payload of the logout token
+type logoutClaims struct {
+	Iss    string                     `json:"iss"`
+	Sub    string                     `json:"sub"`
+	Sid    string                     `json:"sid"`
+	Aud    audience                   `json:"aud"`
+	Iat    *int64                     `json:"iat"`
+	Exp    *int64                     `json:"exp"`
+	Jti    string                     `json:"jti"`
+	Events map[string]json.RawMessage `json:"events"`
+	Nonce  *json.RawMessage           `json:"nonce"`
+}
+
+// The UnmarshalJSON(data) audience-method decodes the claim from a string or an array
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// The verifySignature(key, alg, input, sig) function checks the signature of the token with the public key
+func verifySignature(key crypto.PublicKey, alg string, input string, sig []byte) bool {
+	sum := sha256.Sum256([]byte(input))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return alg == "RS256" && rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k, sum[:], r, s)
+	}
+	return false
+}
+
+// The parseJWT(raw, keys) function checks the signature of the JWT and returns its payload
+func parseJWT(raw string, keys *KeySet) ([]byte, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return nil, ErrUnsupportedAlg
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if keys == nil {
+		return nil, ErrInvalidSignature
+	}
+	verified := false
+	for _, key := range keys.candidates(header.Kid, header.Alg) {
+		if verifySignature(key, header.Alg, parts[0]+"."+parts[1], sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return payload, nil
+}
+
+// The NewLogoutHandler(setings) function creates the back-channel logout receiver.
+// The sessions must be linked to the provider with Bind() after the login.
+// setings - oidc.LogoutSetings public type variable with the provider and the keys.
+func NewLogoutHandler(setings LogoutSetings) *LogoutHandler {
+	if setings.MaxAge <= 0 {
+		setings.MaxAge = GOSESSION_OIDC_LOGOUT_MAX_AGE
+	}
+	return &LogoutHandler{setings: setings, seen: make(map[string]time.Time)}
+}
+
+// The Verify(raw) LogoutHandler-method checks the signature and the claims of the logout token, OpenID Connect Back-Channel Logout 1.0, section 2.6.
+// Each token is accepted only once.
+func (lh *LogoutHandler) Verify(raw string) (LogoutToken, error) {
+	payload, err := parseJWT(raw, lh.setings.Keys)
+	if err != nil {
+		return LogoutToken{}, err
+	}
+	var claims logoutClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return LogoutToken{}, ErrInvalidClaims
+	}
+	presently := time.Now()
+	if claims.Iss != lh.setings.Issuer || claims.Iat == nil || claims.Jti == "" || claims.Nonce != nil {
+		return LogoutToken{}, ErrInvalidClaims
+	}
+	if claims.Sub == "" && claims.Sid == "" {
+		return LogoutToken{}, ErrInvalidClaims
+	}
+	audOk := false
+	for _, aud := range claims.Aud {
+		if aud == lh.setings.ClientId {
+			audOk = true
+		}
+	}
+	if !audOk {
+		return LogoutToken{}, ErrInvalidClaims
+	}
+	event, ok := claims.Events[GOSESSION_OIDC_LOGOUT_EVENT]
+	if !ok || !strings.HasPrefix(strings.TrimSpace(string(event)), "{") {
+		return LogoutToken{}, ErrInvalidClaims
+	}
+	issuedAt := time.Unix(*claims.Iat, 0)
+	if issuedAt.After(presently.Add(GOSESSION_OIDC_CLOCK_SKEW)) || issuedAt.Before(presently.Add(-lh.setings.MaxAge)) {
+		return LogoutToken{}, ErrInvalidClaims
+	}
+	if claims.Exp != nil && time.Unix(*claims.Exp, 0).Before(presently.Add(-GOSESSION_OIDC_CLOCK_SKEW)) {
+		return LogoutToken{}, ErrInvalidClaims
+	}
+
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+	for jti, at := range lh.seen {
+		if at.Before(presently.Add(-lh.setings.MaxAge - GOSESSION_OIDC_CLOCK_SKEW)) {
+			delete(lh.seen, jti)
+		}
+	}
+	if _, ok := lh.seen[claims.Jti]; ok {
+		return LogoutToken{}, ErrTokenReplayed
+	}
+	lh.seen[claims.Jti] = issuedAt
+	return LogoutToken{
+		Issuer:    claims.Iss,
+		Subject:   claims.Sub,
+		SessionId: claims.Sid,
+		Audience:  claims.Aud,
+		IssuedAt:  issuedAt,
+		JTI:       claims.Jti,
+	}, nil
+}
+
+// The ServeHTTP(w, r) LogoutHandler-method receives the logout token and destroys the sessions linked to its "sid",
+// or to its "sub" if the token has no "sid"
+func (lh *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	token, err := lh.Verify(r.PostFormValue("logout_token"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	var destroyed int
+	if token.SessionId != "" {
+		destroyed = gosession.DestroyLinked(GOSESSION_OIDC_LINK_SID, linkValue(token.Issuer, token.SessionId))
+	} else {
+		destroyed = gosession.DestroyLinked(GOSESSION_OIDC_LINK_SUB, linkValue(token.Issuer, token.Subject))
+	}
+	if lh.setings.OnLogout != nil {
+		lh.setings.OnLogout(token, destroyed)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// The linkValue(issuer, value) function returns the value of the session link, the identifiers are unique only within the issuer
+func linkValue(issuer string, value string) string {
+	return issuer + " " + value
+}
+
+// The Bind(id, issuer, subject, sid) function links the session to the user and to the session of the provider,
+// so that the back-channel logout can destroy it. Call it after Login(), with the new session id.
+// id - session of the user.
+// issuer - issuer of the ID token, the "iss" claim.
+// subject - user of the provider, the "sub" claim.
+// sid - session of the provider, the "sid" claim of the ID token, it may be empty.
+func Bind(id gosession.SessionId, issuer string, subject string, sid string) {
+	id.Link(GOSESSION_OIDC_LINK_SUB, linkValue(issuer, subject))
+	if sid != "" {
+		id.Link(GOSESSION_OIDC_LINK_SID, linkValue(issuer, sid))
+	}
+}
@@ -0,0 +1,257 @@
+package oidc
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kwynto/gosession"
+)
+
+const (
+	testIssuer   = "https://idp.example"
+	testClientId = "app"
+)
+
+// Test keys of the provider
+var (
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+// The testJWKS() function returns the JSON Web Key Set with the public test keys
+func testJWKS() []byte {
+	enc := base64.RawURLEncoding.EncodeToString
+	ecX := make([]byte, 32)
+	ecY := make([]byte, 32)
+	testECKey.X.FillBytes(ecX)
+	testECKey.Y.FillBytes(ecY)
+	b, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa1", "use": "sig", "alg": "RS256", "n": enc(testRSAKey.N.Bytes()), "e": enc(big.NewInt(int64(testRSAKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": enc(ecX), "y": enc(ecY)},
+			{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		},
+	})
+	return b
+}
+
+// The signToken(alg, kid, claims) function creates the JWT signed with the test key
+func signToken(alg string, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "logout+jwt"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch alg {
+	case "RS256":
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, sum[:])
+	case "ES256":
+		r, s, _ := ecdsa.Sign(rand.Reader, testECKey, sum[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// The logoutClaimsFor(sub, sid) function returns valid claims of the logout token
+func logoutClaimsFor(sub string, sid string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss":    testIssuer,
+		"aud":    testClientId,
+		"iat":    time.Now().Unix(),
+		"jti":    fmt.Sprintf("jti-%d", time.Now().UnixNano()),
+		"events": map[string]interface{}{GOSESSION_OIDC_LOGOUT_EVENT: map[string]interface{}{}},
+	}
+	if sub != "" {
+		claims["sub"] = sub
+	}
+	if sid != "" {
+		claims["sid"] = sid
+	}
+	return claims
+}
+
+// The testLogoutHandler() function creates the logout receiver with the test keys
+func testLogoutHandler(t *testing.T) *LogoutHandler {
+	keys, err := ParseKeySet(testJWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewLogoutHandler(LogoutSetings{Issuer: testIssuer, ClientId: testClientId, Keys: keys})
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_ParseKeySet(t *testing.T) {
+	keys, err := ParseKeySet(testJWKS()) // calling the tested function
+	// work check
+	if err != nil || len(keys.keys) != 2 {
+		t.Fatalf("Incorrect key set: %v", err)
+	}
+	// work check
+	if len(keys.candidates("rsa1", "RS256")) != 1 || len(keys.candidates("rsa1", "ES256")) != 0 || len(keys.candidates("", "ES256")) != 1 {
+		t.Error("Incorrect choice of the keys.")
+	}
+	// work check
+	if _, err := ParseKeySet([]byte("not json")); err != ErrInvalidJWKS { // calling the tested function
+		t.Error("Invalid key set was parsed.")
+	}
+}
+
+func Test_KeySet_Add(t *testing.T) {
+	keys := NewKeySet()
+	// work check
+	if err := keys.Add("", &testRSAKey.PublicKey); err != nil { // calling the tested function
+		t.Error(err)
+	}
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	// work check
+	if err := keys.Add("", &p384.PublicKey); err != ErrUnsupportedKey { // calling the tested function
+		t.Error("A key on an unsupported curve was added.")
+	}
+}
+
+func Test_Verify(t *testing.T) {
+	lh := testLogoutHandler(t)
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa1", "ES256": "ec1"}[alg]
+		token, err := lh.Verify(signToken(alg, kid, logoutClaimsFor("user", "sid"))) // calling the tested function
+		// work check
+		if err != nil || token.Subject != "user" || token.SessionId != "sid" {
+			t.Errorf("The valid %s token was rejected: %v", alg, err)
+		}
+	}
+
+	claims := logoutClaimsFor("user", "")
+	raw := signToken("RS256", "rsa1", claims)
+	lh.Verify(raw)
+	// work check
+	if _, err := lh.Verify(raw); err != ErrTokenReplayed { // calling the tested function
+		t.Error("The token was accepted twice.")
+	}
+
+	// work check
+	if _, err := lh.Verify(signToken("HS256", "hmac", logoutClaimsFor("user", ""))); err != ErrUnsupportedAlg { // calling the tested function
+		t.Error("The HMAC token was accepted.")
+	}
+
+	parts := strings.Split(signToken("RS256", "rsa1", logoutClaimsFor("user", "")), ".")
+	forged, _ := json.Marshal(logoutClaimsFor("admin", ""))
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+	// work check
+	if _, err := lh.Verify(strings.Join(parts, ".")); err != ErrInvalidSignature { // calling the tested function
+		t.Error("The forged token was accepted.")
+	}
+
+	invalid := []func(map[string]interface{}){
+		func(c map[string]interface{}) { c["iss"] = "https://other.example" },
+		func(c map[string]interface{}) { c["aud"] = []string{"other"} },
+		func(c map[string]interface{}) { c["iat"] = time.Now().Add(-time.Hour).Unix() },
+		func(c map[string]interface{}) { delete(c, "jti") },
+		func(c map[string]interface{}) { delete(c, "events") },
+		func(c map[string]interface{}) { c["nonce"] = "n" },
+		func(c map[string]interface{}) { delete(c, "sub") },
+	}
+	for i, change := range invalid {
+		claims := logoutClaimsFor("user", "")
+		change(claims)
+		// work check
+		if _, err := lh.Verify(signToken("ES256", "ec1", claims)); err != ErrInvalidClaims { // calling the tested function
+			t.Errorf("Invalid claims %d were accepted: %v", i, err)
+		}
+	}
+}
+
+func Test_LogoutHandler(t *testing.T) {
+	var destroyedCount int
+	keys, _ := ParseKeySet(testJWKS())
+	lh := NewLogoutHandler(LogoutSetings{
+		Issuer:   testIssuer,
+		ClientId: testClientId,
+		Keys:     keys,
+		OnLogout: func(token LogoutToken, destroyed int) {
+			destroyedCount = destroyed
+		},
+	})
+
+	laptop := startTestSession()
+	Bind(laptop, testIssuer, "user", "sid-laptop")
+	phone := startTestSession()
+	Bind(phone, testIssuer, "user", "sid-phone")
+	other := startTestSession()
+	Bind(other, testIssuer, "other", "sid-other")
+
+	post := func(token string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/backchannel-logout", strings.NewReader(url.Values{"logout_token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		lh.ServeHTTP(w, r) // calling the tested function
+		return w.Code
+	}
+
+	// work check
+	if post(signToken("RS256", "rsa1", logoutClaimsFor("user", "sid-laptop"))) != http.StatusOK || destroyedCount != 1 {
+		t.Fatal("The session was not destroyed by sid.")
+	}
+	// work check
+	if laptop.GetAll() != nil || phone.GetAll() == nil {
+		t.Error("A wrong session was destroyed by sid.")
+	}
+
+	// work check
+	if post(signToken("RS256", "rsa1", logoutClaimsFor("user", ""))) != http.StatusOK || destroyedCount != 1 {
+		t.Fatal("The sessions were not destroyed by sub.")
+	}
+	// work check
+	if phone.GetAll() != nil || other.GetAll() == nil {
+		t.Error("A wrong session was destroyed by sub.")
+	}
+
+	// work check
+	if post("bad token") != http.StatusBadRequest {
+		t.Error("The invalid token was accepted.")
+	}
+	w := httptest.NewRecorder()
+	lh.ServeHTTP(w, httptest.NewRequest("GET", "/backchannel-logout", nil)) // calling the tested function
+	// work check
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Handler returned status: %v", w.Code)
+	}
+	gosession.DestroyLinked(GOSESSION_OIDC_LINK_SUB, linkValue(testIssuer, "other"))
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_Verify(b *testing.B) {
+	keys, _ := ParseKeySet(testJWKS())
+	lh := NewLogoutHandler(LogoutSetings{Issuer: testIssuer, ClientId: testClientId, Keys: keys})
+	claims := logoutClaimsFor("user", "")
+	for i := 0; i < b.N; i++ {
+		claims["jti"] = fmt.Sprintf("jti-%d", i)
+		lh.Verify(signToken("ES256", "ec1", claims)) // calling the tested function
+	}
+}
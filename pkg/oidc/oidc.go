@@ -0,0 +1,180 @@
+// This package helps to implement the login through an OAuth2/OIDC identity provider with GoSession.
+// It keeps the state, the nonce and the PKCE code verifier in the session between the redirect to the provider and the callback.
+package oidc
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Kwynto/gosession"
+)
+
+const (
+	GOSESSION_OIDC_KEY_PREFIX string        = "gosession.oidc." // Prefix of the reserved session variables, one variable per login flow
+	GOSESSION_OIDC_TTL        time.Duration = 10 * time.Minute  // Time for which the user must return from the provider
+	GOSESSION_OIDC_PKCE       string        = "S256"            // PKCE code challenge method
+)
+
+// The errors returned by the callback checks
+var (
+	ErrInvalidState  = errors.New("oidc: unknown, expired or already used state")
+	ErrNonceMismatch = errors.New("oidc: the nonce of the ID token does not match")
+	ErrMissingCode   = errors.New("oidc: the callback has no authorization code")
+)
+
+// The ProviderError type is the error returned by the identity provider to the callback
+type ProviderError struct {
+	Code        string // Value of the "error" parameter
+	Description string // Value of the "error_description" parameter
+}
+
+// The Flow type contains the values of one login flow.
+// A session can have several flows at once, for example when the login page is opened in two tabs.
+type Flow struct {
+	State        string    // Value of the "state" parameter, it identifies the flow
+	Nonce        string    // Value of the "nonce" parameter, it must be equal to the nonce claim of the ID token
+	CodeVerifier string    // PKCE code verifier, it is sent to the token endpoint
+	ReturnTo     string    // Local address to return the user to after the login
+	Created      time.Time // Time of the beginning of the flow
+}
+
+func init() {
+	gob.Register(Flow{}) // the flows are kept in the session, so persistent stores must be able to encode them
+}
+
+// The randomString() function generates a random URL-safe string of 256 bits
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// The Error() ProviderError-method returns the text of the error
+func (pe *ProviderError) Error() string {
+	if pe.Description == "" {
+		return "oidc: the provider returned the error " + pe.Code
+	}
+	return "oidc: the provider returned the error " + pe.Code + ": " + pe.Description
+}
+
+// The CodeChallenge() Flow-method returns the PKCE code challenge for the code verifier
+func (f Flow) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(f.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// The Params() Flow-method returns the parameters of the flow to be added to the authorization request
+func (f Flow) Params() url.Values {
+	return url.Values{
+		"state":                 {f.State},
+		"nonce":                 {f.Nonce},
+		"code_challenge":        {f.CodeChallenge()},
+		"code_challenge_method": {GOSESSION_OIDC_PKCE},
+	}
+}
+
+// The AuthURL(endpoint, params) Flow-method returns the address of the authorization request with the parameters of the flow.
+// endpoint - authorization endpoint of the provider.
+// params - other parameters, for example client_id, redirect_uri, response_type and scope.
+func (f Flow) AuthURL(endpoint string, params url.Values) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	for k, v := range f.Params() {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// The VerifyNonce(nonce) Flow-method compares the nonce claim of the ID token with the nonce of the flow
+func (f Flow) VerifyNonce(nonce string) error {
+	if f.Nonce == "" || subtle.ConstantTimeCompare([]byte(f.Nonce), []byte(nonce)) != 1 {
+		return ErrNonceMismatch
+	}
+	return nil
+}
+
+// The Begin(id, returnTo) function starts a new login flow and keeps it in the session for GOSESSION_OIDC_TTL.
+// id - session of the user.
+// returnTo - local address to return the user to after the login.
+func Begin(id gosession.SessionId, returnTo string) (Flow, error) {
+	return BeginWithTTL(id, returnTo, GOSESSION_OIDC_TTL)
+}
+
+// The BeginWithTTL(id, returnTo, ttl) function starts a new login flow and keeps it in the session for the ttl.
+// id - session of the user.
+// returnTo - local address to return the user to after the login.
+// ttl - time for which the user must return from the provider.
+func BeginWithTTL(id gosession.SessionId, returnTo string, ttl time.Duration) (Flow, error) {
+	var f Flow
+	var err error
+	if f.State, err = randomString(); err != nil {
+		return Flow{}, err
+	}
+	if f.Nonce, err = randomString(); err != nil {
+		return Flow{}, err
+	}
+	if f.CodeVerifier, err = randomString(); err != nil {
+		return Flow{}, err
+	}
+	f.ReturnTo = returnTo
+	f.Created = time.Now()
+	if err := id.SetWithTTL(GOSESSION_OIDC_KEY_PREFIX+f.State, f, ttl); err != nil {
+		return Flow{}, err
+	}
+	return f, nil
+}
+
+// The Consume(id, state) function returns the flow with the state and removes it from the session,
+// so each flow can be completed only once.
+// id - session of the user.
+// state - value of the "state" parameter of the callback.
+func Consume(id gosession.SessionId, state string) (Flow, error) {
+	if state == "" {
+		return Flow{}, ErrInvalidState
+	}
+	f, ok := id.Take(GOSESSION_OIDC_KEY_PREFIX + state).(Flow)
+	if !ok || subtle.ConstantTimeCompare([]byte(f.State), []byte(state)) != 1 {
+		return Flow{}, ErrInvalidState
+	}
+	return f, nil
+}
+
+// The Callback(id, r) function checks the callback request of the provider and consumes its flow.
+// It returns the flow and the authorization code to be exchanged for tokens with the code verifier of the flow.
+// If the provider returned an error, the flow is consumed and the *ProviderError is returned.
+// id - session of the user.
+// r - callback request.
+func Callback(id gosession.SessionId, r *http.Request) (Flow, string, error) {
+	f, err := Consume(id, r.FormValue("state"))
+	if err != nil {
+		return Flow{}, "", err
+	}
+	if code := r.FormValue("error"); code != "" {
+		return f, "", &ProviderError{Code: code, Description: r.FormValue("error_description")}
+	}
+	code := r.FormValue("code")
+	if code == "" {
+		return f, "", ErrMissingCode
+	}
+	return f, code, nil
+}
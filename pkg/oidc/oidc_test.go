@@ -0,0 +1,160 @@
+package oidc
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Kwynto/gosession"
+)
+
+const GOSESSION_TESTING_ITER int = 100
+
+// The startTestSession() function starts a new session as a handler does
+func startTestSession() gosession.SessionId {
+	var id gosession.SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = gosession.Start(&w, r)
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	return id
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_Begin(t *testing.T) {
+	id := startTestSession()
+	states := make(map[string]bool)
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		f, err := Begin(id, "/account") // calling the tested function
+		// work check
+		if err != nil || len(f.State) != 43 || len(f.Nonce) != 43 || len(f.CodeVerifier) != 43 {
+			t.Fatalf("Incorrect flow: %+v", f)
+		}
+		// work check
+		if states[f.State] {
+			t.Error("The state was repeated.")
+		}
+		states[f.State] = true
+	}
+	// work check
+	if len(id.GetAll()) < GOSESSION_TESTING_ITER {
+		t.Error("The flows were not stored in the session.")
+	}
+}
+
+func Test_CodeChallenge(t *testing.T) {
+	f := Flow{CodeVerifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"}
+	// RFC 7636, appendix B
+	// work check
+	if f.CodeChallenge() != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" { // calling the tested function
+		t.Errorf("Incorrect code challenge: %s", f.CodeChallenge())
+	}
+}
+
+func Test_AuthURL(t *testing.T) {
+	id := startTestSession()
+	f, _ := Begin(id, "/")
+
+	res, err := f.AuthURL("https://idp.example/authorize?prompt=login", url.Values{"client_id": {"app"}}) // calling the tested function
+	// work check
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(res)
+	q := u.Query()
+	sum := sha256.Sum256([]byte(f.CodeVerifier))
+	// work check
+	if q.Get("state") != f.State || q.Get("nonce") != f.Nonce || q.Get("client_id") != "app" || q.Get("prompt") != "login" ||
+		q.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(sum[:]) || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("Incorrect authorization address: %s", res)
+	}
+}
+
+func Test_Consume(t *testing.T) {
+	id := startTestSession()
+	f1, _ := Begin(id, "/one")
+	f2, _ := Begin(id, "/two")
+
+	res, err := Consume(id, f2.State) // calling the tested function
+	// work check
+	if err != nil || res.ReturnTo != "/two" || res.CodeVerifier != f2.CodeVerifier {
+		t.Error("Failed to consume the flow.")
+	}
+	// work check
+	if _, err := Consume(id, f2.State); err != ErrInvalidState { // calling the tested function
+		t.Error("The flow was consumed twice.")
+	}
+	// work check
+	if _, err := Consume(id, "unknown"); err != ErrInvalidState { // calling the tested function
+		t.Error("An unknown state was accepted.")
+	}
+	// work check
+	if res, err := Consume(id, f1.State); err != nil || res.ReturnTo != "/one" { // calling the tested function
+		t.Error("The concurrent flow was lost.")
+	}
+
+	expired, _ := BeginWithTTL(id, "/", -time.Second)
+	// work check
+	if _, err := Consume(id, expired.State); err != ErrInvalidState { // calling the tested function
+		t.Error("An expired flow was accepted.")
+	}
+}
+
+func Test_Callback(t *testing.T) {
+	id := startTestSession()
+
+	f, _ := Begin(id, "/")
+	r := httptest.NewRequest("GET", "/callback?code=abc&state="+f.State, nil)
+	res, code, err := Callback(id, r) // calling the tested function
+	// work check
+	if err != nil || code != "abc" || res.State != f.State {
+		t.Error("Failed to handle the callback.")
+	}
+	// work check
+	if res.VerifyNonce(f.Nonce) != nil || res.VerifyNonce("other") != ErrNonceMismatch {
+		t.Error("Incorrect nonce check.")
+	}
+
+	f, _ = Begin(id, "/")
+	r = httptest.NewRequest("GET", "/callback?error=access_denied&state="+f.State, nil)
+	_, _, err = Callback(id, r) // calling the tested function
+	pe, ok := err.(*ProviderError)
+	// work check
+	if !ok || pe.Code != "access_denied" {
+		t.Errorf("The provider error was not returned: %v", err)
+	}
+	// work check
+	if _, err := Consume(id, f.State); err != ErrInvalidState {
+		t.Error("The failed flow was not consumed.")
+	}
+
+	f, _ = Begin(id, "/")
+	r = httptest.NewRequest("GET", "/callback?state="+f.State, nil)
+	// work check
+	if _, _, err := Callback(id, r); err != ErrMissingCode { // calling the tested function
+		t.Error("The callback without the code was accepted.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_Begin(b *testing.B) {
+	id := startTestSession()
+	for i := 0; i < b.N; i++ {
+		f, _ := Begin(id, "/") // calling the tested function
+		Consume(id, f.State)   // calling the tested function
+	}
+}
@@ -0,0 +1,183 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	GOSESSION_PROBE_WINDOW      time.Duration = time.Minute      // Period during which unknown ids from one client are counted
+	GOSESSION_PROBE_BLOCK_FOR   time.Duration = 15 * time.Minute // Time for which the client is blocked
+	GOSESSION_PROBE_DELAY       time.Duration = time.Second      // Delay of requests of the throttled client
+	GOSESSION_PROBE_MAX_CLIENTS int           = 10_000           // Maximum number of tracked clients
+)
+
+// The ProbeSetings type describes the settings for detecting clients that send unknown session ids.
+// The detection is disabled while both thresholds are zero.
+type ProbeSetings struct {
+	ThrottleThreshold int                                      // Number of unknown ids within the window after which requests of the client are delayed
+	BlockThreshold    int                                      // Number of unknown ids within the window after which the client receives 429 Too Many Requests
+	Window            time.Duration                            // Period during which unknown ids are counted
+	ThrottleDelay     time.Duration                            // Delay of requests of the throttled client
+	BlockFor          time.Duration                            // Time for which the client is blocked
+	MaxClients        int                                      // Maximum number of tracked clients, the least recently seen are forgotten
+	OnProbe           func(ip string, count int, blocked bool) // Called when the client reaches a threshold
+}
+
+// The probeEntry type counts the unknown ids of one client
+type probeEntry struct {
+	ip           string
+	count        int
+	windowStart  time.Time
+	blockedUntil time.Time
+}
+
+// The probeTracker type keeps the counters of clients in the LRU order, so its size is bounded
+type probeTracker struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// Probe detection settings variable
+var setingsProbe = ProbeSetings{
+	Window:        GOSESSION_PROBE_WINDOW,
+	ThrottleDelay: GOSESSION_PROBE_DELAY,
+	BlockFor:      GOSESSION_PROBE_BLOCK_FOR,
+	MaxClients:    GOSESSION_PROBE_MAX_CLIENTS,
+}
+
+// The probes variable stores the counters of unknown ids of all clients
+var probes = &probeTracker{
+	entries: make(map[string]*list.Element),
+	order:   list.New(),
+}
+
+// The enabled() ProbeSetings-method reports whether the detection is enabled
+func (ps ProbeSetings) enabled() bool {
+	return ps.ThrottleThreshold > 0 || ps.BlockThreshold > 0
+}
+
+// The entryLocked(ip) probeTracker-method returns the entry of the client, creating it and forgetting the oldest entries if necessary
+func (pt *probeTracker) entryLocked(ip string) *probeEntry {
+	if el, ok := pt.entries[ip]; ok {
+		pt.order.MoveToFront(el)
+		return el.Value.(*probeEntry)
+	}
+	for setingsProbe.MaxClients > 0 && pt.order.Len() >= setingsProbe.MaxClients {
+		oldest := pt.order.Back()
+		pt.order.Remove(oldest)
+		delete(pt.entries, oldest.Value.(*probeEntry).ip)
+	}
+	entry := &probeEntry{ip: ip}
+	pt.entries[ip] = pt.order.PushFront(entry)
+	return entry
+}
+
+// The record(ip) probeTracker-method counts the unknown id presented by the client
+func (pt *probeTracker) record(ip string) {
+	if !setingsProbe.enabled() {
+		return
+	}
+	presently := clockNow()
+	pt.mu.Lock()
+	entry := pt.entryLocked(ip)
+	if presently.Sub(entry.windowStart) > setingsProbe.Window {
+		entry.count = 0
+		entry.windowStart = presently
+	}
+	entry.count++
+	count := entry.count
+	notify := count == setingsProbe.ThrottleThreshold
+	blocked := setingsProbe.BlockThreshold > 0 && count >= setingsProbe.BlockThreshold && !presently.Before(entry.blockedUntil)
+	if blocked {
+		entry.blockedUntil = presently.Add(setingsProbe.BlockFor)
+		notify = true
+	}
+	pt.mu.Unlock()
+	if blocked {
+		logS(GOSESSION_LOG_WARN, "client blocked for unknown session ids", "ip", ip, "count", count)
+	} else if notify {
+		logS(GOSESSION_LOG_WARN, "client throttled for unknown session ids", "ip", ip, "count", count)
+	}
+	if notify && setingsProbe.OnProbe != nil {
+		setingsProbe.OnProbe(ip, count, blocked)
+	}
+}
+
+// The status(ip) probeTracker-method returns the time until which the client is blocked and whether it is throttled
+func (pt *probeTracker) status(ip string) (time.Time, bool) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	el, ok := pt.entries[ip]
+	if !ok {
+		return time.Time{}, false
+	}
+	entry := el.Value.(*probeEntry)
+	throttled := setingsProbe.ThrottleThreshold > 0 && entry.count >= setingsProbe.ThrottleThreshold &&
+		clockNow().Sub(entry.windowStart) <= setingsProbe.Window
+	return entry.blockedUntil, throttled
+}
+
+// The reset() probeTracker-method forgets all clients
+func (pt *probeTracker) reset() {
+	pt.mu.Lock()
+	pt.entries = make(map[string]*list.Element)
+	pt.order.Init()
+	pt.mu.Unlock()
+}
+
+// The checkUnknownId(r) function is called when the session is not found in the store,
+// if the client presented a session id in the cookie, the request is counted as a probe.
+func checkUnknownId(r *http.Request) {
+	if id, ok := getCookieId(r); ok {
+		logS(GOSESSION_LOG_DEBUG, "unknown session id", "session", logKey(id.key(), id), "ip", clientIP(r))
+		probes.record(clientIP(r))
+	}
+}
+
+// The ProbeGuard(next) middleware delays the requests of clients that sent too many unknown session ids
+// and responds 429 Too Many Requests to blocked clients. Unknown ids are counted by Start() and StartSecure().
+func ProbeGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if setingsProbe.enabled() {
+			blockedUntil, throttled := probes.status(clientIP(r))
+			if wait := blockedUntil.Sub(clockNow()); wait > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			if throttled {
+				time.Sleep(setingsProbe.ThrottleDelay)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The SetProbeSetings(setings) sets new settings for detecting clients that send unknown session ids.
+// The counters of all clients are reset.
+// setings - gosession.ProbeSetings public type variable for setting new detection settings
+func SetProbeSetings(setings ProbeSetings) {
+	if setings.Window <= 0 {
+		setings.Window = GOSESSION_PROBE_WINDOW
+	}
+	if setings.ThrottleDelay <= 0 {
+		setings.ThrottleDelay = GOSESSION_PROBE_DELAY
+	}
+	if setings.BlockFor <= 0 {
+		setings.BlockFor = GOSESSION_PROBE_BLOCK_FOR
+	}
+	if setings.MaxClients <= 0 {
+		setings.MaxClients = GOSESSION_PROBE_MAX_CLIENTS
+	}
+	setingsProbe = setings
+	probes.reset()
+}
@@ -0,0 +1,138 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// The probeRequest(ip) function creates a request with an unknown session id from the client
+func probeRequest(ip string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = ip + ":1234"
+	r.AddCookie(&http.Cookie{Name: setingsSession.CookieName, Value: string(generateId())})
+	return r
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_checkUnknownId(t *testing.T) {
+	var events []bool
+	SetProbeSetings(ProbeSetings{
+		ThrottleThreshold: 3,
+		BlockThreshold:    5,
+		OnProbe: func(ip string, count int, blocked bool) {
+			events = append(events, blocked)
+		},
+	})
+	defer SetProbeSetings(ProbeSetings{})
+
+	// requests without cookies are not probes
+	for i := 0; i < 10; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		checkUnknownId(r) // calling the tested function
+	}
+	// work check
+	if _, throttled := probes.status("192.0.2.1"); throttled {
+		t.Error("The client without the cookie was throttled.")
+	}
+
+	for i := 0; i < 3; i++ {
+		checkUnknownId(probeRequest("192.0.2.2")) // calling the tested function
+	}
+	blockedUntil, throttled := probes.status("192.0.2.2")
+	// work check
+	if !throttled || !blockedUntil.IsZero() || len(events) != 1 || events[0] {
+		t.Error("The client was not throttled.")
+	}
+
+	for i := 0; i < 2; i++ {
+		checkUnknownId(probeRequest("192.0.2.2")) // calling the tested function
+	}
+	blockedUntil, _ = probes.status("192.0.2.2")
+	// work check
+	if !blockedUntil.After(time.Now()) || len(events) != 2 || !events[1] {
+		t.Error("The client was not blocked.")
+	}
+}
+
+func Test_probeTracker(t *testing.T) {
+	SetProbeSetings(ProbeSetings{BlockThreshold: 1, MaxClients: 10})
+	defer SetProbeSetings(ProbeSetings{})
+
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		probes.record(fmt.Sprintf("192.0.2.%d", i)) // calling the tested function
+	}
+	// work check
+	if len(probes.entries) != 10 || probes.order.Len() != 10 {
+		t.Errorf("The tracker is not bounded: %d", len(probes.entries))
+	}
+	// work check
+	if _, ok := probes.entries[fmt.Sprintf("192.0.2.%d", GOSESSION_TESTING_ITER-1)]; !ok {
+		t.Error("The most recent client was forgotten.")
+	}
+}
+
+func Test_ProbeGuard(t *testing.T) {
+	SetProbeSetings(ProbeSetings{BlockThreshold: 3})
+	defer SetProbeSetings(ProbeSetings{})
+
+	handler := ProbeGuard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Start(&w, r)
+		io.WriteString(w, "OK")
+	}))
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, probeRequest("192.0.2.3")) // calling the tested function
+		// work check
+		if w.Code != http.StatusOK {
+			t.Errorf("Handler returned status: %v", w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, probeRequest("192.0.2.3")) // calling the tested function
+	// work check
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Handler returned status: %v", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, probeRequest("192.0.2.4")) // calling the tested function
+	// work check
+	if w.Code != http.StatusOK {
+		t.Errorf("Another client was blocked, status: %v", w.Code)
+	}
+}
+
+func Test_SetProbeSetings(t *testing.T) {
+	SetProbeSetings(ProbeSetings{BlockThreshold: 10}) // calling the tested function
+	defer SetProbeSetings(ProbeSetings{})
+	// work check
+	if !setingsProbe.enabled() || setingsProbe.Window != GOSESSION_PROBE_WINDOW || setingsProbe.MaxClients != GOSESSION_PROBE_MAX_CLIENTS {
+		t.Error("Failed to change settings.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_record(b *testing.B) {
+	SetProbeSetings(ProbeSetings{BlockThreshold: 1_000_000})
+	defer SetProbeSetings(ProbeSetings{})
+	for i := 0; i < b.N; i++ {
+		probes.record("192.0.2.1") // calling the tested function
+	}
+}
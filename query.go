@@ -0,0 +1,262 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"sort"
+	"time"
+)
+
+// The SessionFilter type is the condition for selecting sessions by their description and variables, nil selects all sessions.
+// The filter receives a copy of the variables and is called without the internal lock, so it may use GoSession itself,
+// except for the filter of DestroyWhere(), which is also called under the lock.
+type SessionFilter func(info SessionInfo, data Session) bool
+
+// The queryKeys type reads the keys of the sessions in memory and in the store in sorted order page by page.
+// The keys in memory are taken and sorted once, when the iteration starts, so the sessions put in memory later may be missed.
+type queryKeys struct {
+	memory []string // Sorted keys in memory that are not read yet
+	cursor string   // Cursor of the store
+	done   bool
+}
+
+// The newQueryKeysS(cursor) function safely takes the sorted keys of the sessions in memory after the cursor and starts the iteration
+func newQueryKeysS(cursor string) *queryKeys {
+	block.RLock()
+	memory := make([]string, 0, len(allSessions))
+	for key := range allSessions {
+		if string(key) > cursor {
+			memory = append(memory, string(key))
+		}
+	}
+	block.RUnlock()
+	sort.Strings(memory)
+	return &queryKeys{memory: memory, cursor: cursor}
+}
+
+// The nextS(limit) queryKeys-method returns up to limit next keys, an empty page means the end
+func (qk *queryKeys) nextS(limit int) ([]string, error) {
+	if qk.done {
+		return nil, nil
+	}
+	memKeys := qk.memory
+	memNext := ""
+	if len(memKeys) > limit {
+		memKeys = memKeys[:limit]
+		memNext = memKeys[limit-1]
+	}
+	keys, next := memKeys, memNext
+	if store := setingsSession.Store; store != nil {
+		storeKeys, storeNext, err := storeScan(store, qk.cursor, limit)
+		if err != nil {
+			return nil, err
+		}
+		keys, next = mergeScan(memKeys, memNext, storeKeys, storeNext, limit)
+	}
+	if next == "" {
+		qk.done = true
+		qk.memory = nil
+		return keys, nil
+	}
+	qk.cursor = next
+	qk.memory = qk.memory[sort.Search(len(qk.memory), func(i int) bool { return qk.memory[i] > next }):]
+	return keys, nil
+}
+
+// The querySessionS(key, now) function safely reads the live session from memory or from the store without keeping it in memory.
+// It returns the session, its description and a copy of its variables.
+func querySessionS(key SessionId, now time.Time) (internalSession, SessionInfo, Session, bool) {
+	block.RLock()
+	ses, ok := allSessions[key]
+	data := make(Session)
+	if ok {
+		for k, v := range ses.liveData(now.UnixNano()) {
+			data[k] = v
+		}
+	}
+	block.RUnlock()
+	if !ok {
+		store := setingsSession.Store
+		if store == nil {
+			return internalSession{}, SessionInfo{}, nil, false
+		}
+		b, err := storeLoad(store, string(key))
+		if err != nil {
+			return internalSession{}, SessionInfo{}, nil, false
+		}
+		ses, err = decodeSession(b)
+		if err != nil {
+			return internalSession{}, SessionInfo{}, nil, false
+		}
+		data = ses.liveData(now.UnixNano())
+	}
+	if ses.expiration < now.Unix() {
+		return internalSession{}, SessionInfo{}, nil, false
+	}
+	return ses, ses.info(key, ""), data, true
+}
+
+// The querySessionLocked(key, now) function reads the live session from memory or from the store without keeping it in memory,
+// the block must be locked. It returns the session, its description and a copy of its variables.
+func querySessionLocked(key SessionId, now time.Time) (internalSession, SessionInfo, Session, bool) {
+	ses, ok := allSessions[key]
+	if !ok {
+		store := setingsSession.Store
+		if store == nil {
+			return internalSession{}, SessionInfo{}, nil, false
+		}
+		b, err := storeLoadLocked(store, string(key))
+		if err != nil {
+			return internalSession{}, SessionInfo{}, nil, false
+		}
+		if ses, err = decodeSession(b); err != nil {
+			return internalSession{}, SessionInfo{}, nil, false
+		}
+	}
+	if ses.expiration < now.Unix() {
+		return internalSession{}, SessionInfo{}, nil, false
+	}
+	data := make(Session)
+	for k, v := range ses.liveData(now.UnixNano()) {
+		data[k] = v
+	}
+	return ses, ses.info(key, ""), data, true
+}
+
+// The queryS(cursor, filter, fn) function calls fn for each live session selected by the filter in the order of their keys, starting after the cursor.
+// The keys are read page by page, so the sessions of a large store are never loaded at once. The iteration stops when fn returns false.
+func queryS(cursor string, filter SessionFilter, fn func(key SessionId, ses internalSession, info SessionInfo, data Session) bool) error {
+	qk := newQueryKeysS(cursor)
+	for {
+		keys, err := qk.nextS(GOSESSION_SCAN_PAGE)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		now := clockNow()
+		for _, key := range keys {
+			ses, info, data, ok := querySessionS(SessionId(key), now)
+			if !ok || (filter != nil && !filter(info, data)) {
+				continue
+			}
+			if !fn(SessionId(key), ses, info, data) {
+				return nil
+			}
+		}
+	}
+}
+
+// The removeKeyS(key, name) function safely deletes the variable from the session in memory or directly in the store
+func removeKeyS(key SessionId, name string) bool {
+	block.Lock()
+	defer unlockS()
+	ses, cached := allSessions[key]
+	if !cached {
+		if setingsSession.Store == nil {
+			return false
+		}
+		b, err := storeLoadLocked(setingsSession.Store, string(key))
+		if err != nil {
+			return false
+		}
+		if ses, err = decodeSession(b); err != nil {
+			return false
+		}
+	}
+	if _, ok := ses.data[name]; !ok {
+		return false
+	}
+	delete(ses.data, name)
+	ses = ses.withDeadline(name, 0)
+	if cached {
+		putLocked(key, ses)
+	} else {
+		saveStoreLocked(key, ses)
+	}
+	emitLocked(GOSESSION_EVENT_CHANGE, key, idOfKey(key), "", ses)
+	return true
+}
+
+// The Scan(cursor, limit, filter) function returns up to limit live sessions selected by the filter in the order of their keys,
+// and the cursor for the next call, an empty next cursor means the end.
+// The sessions are read from memory and from the persistent store, the sessions of the store are not loaded into memory.
+// The cursor contains the key of the session in the store, so it must not be shown to clients.
+// cursor - the next cursor of the previous call, empty for the first call.
+// limit - the maximum number of sessions, 0 - GOSESSION_SCAN_PAGE.
+// filter - the condition for selecting sessions, nil - all sessions.
+func Scan(cursor string, limit int, filter SessionFilter) ([]SessionInfo, string, error) {
+	if limit <= 0 {
+		limit = GOSESSION_SCAN_PAGE
+	}
+	res := make([]SessionInfo, 0)
+	last := ""
+	next := ""
+	err := queryS(cursor, filter, func(key SessionId, ses internalSession, info SessionInfo, data Session) bool {
+		if len(res) == limit {
+			next = last
+			return false
+		}
+		res = append(res, info)
+		last = string(key)
+		return true
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return res, next, nil
+}
+
+// The Range(filter, fn) function calls fn with the description and a copy of the variables of each live session selected by the filter.
+// The iteration stops when fn returns false. The sessions created or changed during the iteration may be missed.
+// filter - the condition for selecting sessions, nil - all sessions.
+// fn - the function called for each session.
+func Range(filter SessionFilter, fn func(info SessionInfo, data Session) bool) error {
+	return queryS("", filter, func(key SessionId, ses internalSession, info SessionInfo, data Session) bool {
+		return fn(info, data)
+	})
+}
+
+// The DestroyWhere(filter) function destroys all live sessions selected by the filter and returns their number,
+// for example to sign out all users with a certain role. The destroy hooks are called for each session.
+// Right before a session is destroyed, the filter is called again under the internal lock with its current state,
+// so that a session changed in the meantime is kept, therefore this filter must not use GoSession.
+// filter - the condition for selecting sessions, nil - all sessions.
+func DestroyWhere(filter SessionFilter) (int, error) {
+	count := 0
+	err := queryS("", filter, func(key SessionId, ses internalSession, info SessionInfo, data Session) bool {
+		block.Lock()
+		ses, info, data, ok := querySessionLocked(key, clockNow())
+		if ok && (filter == nil || filter(info, data)) {
+			emitLocked(GOSESSION_EVENT_DESTROY, key, idOfKey(key), "", ses)
+			dropLocked(key)
+			count++
+		}
+		unlockS()
+		return true
+	})
+	return count, err
+}
+
+// The RemoveKeyWhere(name, filter) function deletes the variable from all live sessions selected by the filter and returns the number of changed sessions,
+// for example to clear the carts after a price change. The filter is called only for the sessions that have the variable.
+// name - session variable name.
+// filter - the condition for selecting sessions, nil - all sessions.
+func RemoveKeyWhere(name string, filter SessionFilter) (int, error) {
+	count := 0
+	err := queryS("", func(info SessionInfo, data Session) bool {
+		if _, ok := data[name]; !ok {
+			return false
+		}
+		return filter == nil || filter(info, data)
+	}, func(key SessionId, ses internalSession, info SessionInfo, data Session) bool {
+		if removeKeyS(key, name) {
+			count++
+		}
+		return true
+	})
+	return count, err
+}
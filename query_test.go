@@ -0,0 +1,289 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"sort"
+	"testing"
+)
+
+// The startQuerySessions(n, role) function creates n sessions with the role variable and the cart
+func startQuerySessions(n int, role string) []SessionId {
+	ids := make([]SessionId, 0, n)
+	for i := 0; i < n; i++ {
+		id := startTestSession()
+		id.Set("role", role)
+		id.Set("cart", i)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// The roleFilter(role) function returns the filter of the sessions with the role
+func roleFilter(role string) SessionFilter {
+	return func(info SessionInfo, data Session) bool {
+		return data["role"] == role
+	}
+}
+
+// The forgetMemory(ids) function removes the sessions from memory, so that they are only in the store
+func forgetMemory(ids []SessionId) {
+	block.Lock()
+	for _, id := range ids {
+		dropLocked(id.key())
+	}
+	block.Unlock()
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_Scan(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+	ids := startQuerySessions(GOSESSION_TESTING_ITER, "scan")
+	for _, id := range ids[:GOSESSION_TESTING_ITER/2] {
+		ms.Delete(string(id.key()))
+	}
+	defer DestroyWhere(roleFilter("scan"))
+	stored := startQuerySessions(GOSESSION_TESTING_ITER, "scan")
+	restartMemory(stored)
+
+	seen := make(map[string]int)
+	cursor := ""
+	for {
+		page, next, err := Scan(cursor, 7, roleFilter("scan")) // calling the tested function
+		if err != nil {
+			t.Fatal(err)
+		}
+		// work check
+		if len(page) > 7 {
+			t.Fatalf("The page has %v sessions.", len(page))
+		}
+		for _, info := range page {
+			seen[info.Handle]++
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	for _, id := range append(ids, stored...) {
+		// work check
+		if seen[id.key().handle()] != 1 {
+			t.Errorf("The session was returned %v times.", seen[id.key().handle()])
+		}
+	}
+	block.RLock()
+	_, loaded := allSessions[stored[0].key()]
+	block.RUnlock()
+	// work check
+	if loaded {
+		t.Error("The session of the store was loaded into memory.")
+	}
+}
+
+func Test_Scan_next(t *testing.T) {
+	ids := startQuerySessions(3, "last")
+	defer DestroyWhere(roleFilter("last"))
+
+	page, next, err := Scan("", 3, roleFilter("last")) // calling the tested function
+	// work check
+	if err != nil || len(page) != 3 || next != "" {
+		t.Errorf("Incorrect last page: %v %q %v", len(page), next, err)
+	}
+	page, next, err = Scan("", 2, roleFilter("last")) // calling the tested function
+	// work check
+	if err != nil || len(page) != 2 || next == "" {
+		t.Errorf("Incorrect first page: %v %q %v", len(page), next, err)
+	}
+	ids[0].destroyS()
+}
+
+func Test_queryKeys(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+	ids := startQuerySessions(5, "keys")
+	defer DestroyWhere(roleFilter("keys"))
+	stored := startQuerySessions(5, "keys")
+	forgetMemory(stored)
+	for _, id := range stored {
+		ms.Save(string(id.key()), encodedTestSession(1<<40, "role", "keys"), 1<<40)
+	}
+	want := make([]string, 0)
+	for _, id := range append(ids, stored...) {
+		want = append(want, string(id.key()))
+	}
+	sort.Strings(want)
+
+	qk := newQueryKeysS("") // calling the tested function
+	got := make([]string, 0)
+	for {
+		page, err := qk.nextS(3) // calling the tested function
+		if err != nil {
+			t.Fatal(err)
+		}
+		// work check
+		if len(page) > 3 {
+			t.Fatalf("The page has %v keys.", len(page))
+		}
+		if len(page) == 0 {
+			break
+		}
+		got = append(got, page...)
+	}
+	// work check
+	if !sort.StringsAreSorted(got) {
+		t.Fatal("The keys are not sorted.")
+	}
+	found := 0
+	for i, key := range got {
+		// work check
+		if i > 0 && got[i-1] == key {
+			t.Fatalf("The key was returned twice: %v", key)
+		}
+		if j := sort.SearchStrings(want, key); j < len(want) && want[j] == key {
+			found++
+		}
+	}
+	// work check
+	if found != len(want) {
+		t.Errorf("Keys are missing: %v of %v", found, len(want))
+	}
+}
+
+func Test_Range(t *testing.T) {
+	ids := startQuerySessions(3, "range")
+	defer DestroyWhere(roleFilter("range"))
+
+	count := 0
+	err := Range(roleFilter("range"), func(info SessionInfo, data Session) bool { // calling the tested function
+		data["role"] = "changed"
+		count++
+		return count < 2
+	})
+	// work check
+	if err != nil || count != 2 {
+		t.Errorf("Incorrect iteration: %v %v", count, err)
+	}
+	// work check
+	if ids[0].Get("role") != "range" {
+		t.Error("The filter changed the session.")
+	}
+}
+
+func Test_DestroyWhere(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+	trial := startQuerySessions(4, "trial")
+	paid := startQuerySessions(2, "paid")
+	defer DestroyWhere(roleFilter("paid"))
+	forgetMemory(trial[:2])
+	for _, id := range trial[:2] {
+		ms.Save(string(id.key()), encodedTestSession(1<<40, "role", "trial"), 1<<40)
+	}
+	destroyed := make(map[string]bool)
+	t.Cleanup(ResetHooks)
+	OnDestroy(func(e SessionEvent) {
+		if e.Data["role"] == "trial" {
+			destroyed[e.Handle] = true
+		}
+	})
+
+	n, err := DestroyWhere(roleFilter("trial")) // calling the tested function
+	// work check
+	if err != nil || n != 4 || len(destroyed) != 4 {
+		t.Errorf("Incorrect number of destroyed sessions: %v %v %v", n, len(destroyed), err)
+	}
+	for _, id := range trial {
+		// work check
+		if id.GetAll() != nil {
+			t.Error("The session was not destroyed.")
+		}
+	}
+	// work check
+	if paid[0].Get("role") != "paid" {
+		t.Error("The session of another role was destroyed.")
+	}
+}
+
+func Test_DestroyWhere_changed(t *testing.T) {
+	ids := startQuerySessions(2, "changed")
+	defer DestroyWhere(roleFilter("paid"))
+	changed := false
+	filter := func(info SessionInfo, data Session) bool {
+		if data["role"] != "changed" {
+			return false
+		}
+		if !changed && info.Handle == ids[0].key().handle() {
+			changed = true
+			ids[0].Set("role", "paid")
+		}
+		return true
+	}
+
+	n, err := DestroyWhere(filter) // calling the tested function
+	// work check
+	if err != nil || n != 1 || ids[1].GetAll() != nil {
+		t.Errorf("Incorrect number of destroyed sessions: %v %v", n, err)
+	}
+	// work check
+	if ids[0].Get("role") != "paid" {
+		t.Error("The session changed after the selection was destroyed.")
+	}
+}
+
+func Test_RemoveKeyWhere(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+	ids := startQuerySessions(4, "cart")
+	defer func() {
+		for _, id := range ids {
+			id.destroyS()
+		}
+	}()
+	forgetMemory(ids[:2])
+	for _, id := range ids[:2] {
+		ms.Save(string(id.key()), encodedTestSession(1<<40, "cart", 1), 1<<40)
+	}
+	ids[3].Remove("cart")
+
+	n, err := RemoveKeyWhere("cart", nil) // calling the tested function
+	// work check
+	if err != nil || n < 3 {
+		t.Errorf("Incorrect number of changed sessions: %v %v", n, err)
+	}
+	block.RLock()
+	_, loaded := allSessions[ids[0].key()]
+	block.RUnlock()
+	// work check
+	if loaded {
+		t.Error("The session of the store was loaded into memory.")
+	}
+	for _, id := range ids {
+		// work check
+		if id.Get("cart") != nil {
+			t.Error("The variable was not removed.")
+		}
+	}
+	// work check
+	if ids[2].Get("role") != "cart" {
+		t.Error("Other variables were removed.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_Scan(b *testing.B) {
+	startQuerySessions(GOSESSION_TESTING_ITER, "bench")
+	defer DestroyWhere(roleFilter("bench"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Scan("", GOSESSION_SCAN_PAGE, roleFilter("bench")) // calling the tested function
+	}
+}
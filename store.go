@@ -0,0 +1,303 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	GOSESSION_SCAN_PAGE int = 100 // Number of keys requested from the store at a time
+)
+
+// The ErrNotFound error is returned by the Store when there is no entry with the requested key
+var ErrNotFound = errors.New("gosession: session not found in the store")
+
+// The Store interface describes a persistent storage of serialized sessions.
+// The session system keeps working sessions in memory and writes every change through to the store,
+// sessions that are missing in memory (for example after a restart) are loaded from the store.
+// The values put into the session must be registered with gob.Register() if they are not basic types.
+type Store interface {
+	// Load returns the serialized session or ErrNotFound
+	Load(key string) ([]byte, error)
+	// Save writes the serialized session, expiration is the Unix time after which the entry may be deleted
+	Save(key string, data []byte, expiration int64) error
+	// Delete removes the entry, deleting a missing entry is not an error
+	Delete(key string) error
+	// Scan returns up to limit keys following the cursor and the cursor for the next call, an empty next cursor means the end
+	Scan(cursor string, limit int) (keys []string, next string, err error)
+}
+
+// The storedSession type is the serialized representation of the internalSession
+type storedSession struct {
+	Expiration int64
+	Data       Session
+	CSRF       []byte
+	Flashes    []Flash
+	UserId     string
+	AuthAt     int64
+	AuthTimes  map[AuthLevel]int64
+	Created    int64
+	LastSeen   int64
+	IP         string
+	UserAgent  string
+	Deadlines  map[string]int64
+	Links      map[string]string
+}
+
+// The encodeSession(ses) function serializes the session for the store
+func encodeSession(ses internalSession) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(storedSession{
+		Expiration: ses.expiration,
+		Data:       ses.data,
+		CSRF:       ses.csrf,
+		Flashes:    ses.flashes,
+		UserId:     ses.userId,
+		AuthAt:     ses.authAt,
+		AuthTimes:  ses.authTimes,
+		Created:    ses.created,
+		LastSeen:   ses.lastSeen,
+		IP:         ses.ip,
+		UserAgent:  ses.userAgent,
+		Deadlines:  ses.deadlines,
+		Links:      ses.links,
+	})
+	return buf.Bytes(), err
+}
+
+// The decodeSession(b) function restores the session from its serialized representation
+func decodeSession(b []byte) (internalSession, error) {
+	var st storedSession
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&st); err != nil {
+		return internalSession{}, err
+	}
+	if st.Data == nil {
+		st.Data = make(Session, 0)
+	}
+	return internalSession{
+		expiration: st.Expiration,
+		data:       st.Data,
+		csrf:       st.CSRF,
+		flashes:    st.Flashes,
+		userId:     st.UserId,
+		authAt:     st.AuthAt,
+		authTimes:  st.AuthTimes,
+		created:    st.Created,
+		lastSeen:   st.LastSeen,
+		ip:         st.IP,
+		userAgent:  st.UserAgent,
+		deadlines:  st.Deadlines,
+		links:      st.Links,
+	}, nil
+}
+
+// The SessionRecord type is the session decoded from the persistent store, for tools that inspect the store offline
+type SessionRecord struct {
+	Handle     string // Public handle of the session, see SessionInfo
+	UserId     string
+	Created    time.Time
+	LastSeen   time.Time
+	Expiration time.Time
+	IP         string
+	UserAgent  string
+	Data       Session
+	Links      map[string]string
+}
+
+// The DecodeRecord(key, data) function decodes the serialized session read from the store.
+// The types stored in the session must be registered with gob.Register(), as in the application.
+// key - key of the entry in the store.
+// data - the serialized session, decrypted if the store is encrypted.
+func DecodeRecord(key string, data []byte) (SessionRecord, error) {
+	ses, err := decodeSession(data)
+	if err != nil {
+		return SessionRecord{}, err
+	}
+	return SessionRecord{
+		Handle:     HandleOf(key),
+		UserId:     ses.userId,
+		Created:    time.Unix(ses.created, 0),
+		LastSeen:   time.Unix(ses.lastSeen, 0),
+		Expiration: time.Unix(ses.expiration, 0),
+		IP:         ses.ip,
+		UserAgent:  ses.userAgent,
+		Data:       ses.data,
+		Links:      ses.links,
+	}, nil
+}
+
+// The saveStoreLocked(key, ses) function writes the session through to the store from the settings, the block must be locked.
+// A session that cannot be encoded, for example with a type not registered with gob.Register(), is counted and logged as a failed save.
+func saveStoreLocked(key SessionId, ses internalSession) error {
+	if setingsSession.Store == nil {
+		return nil
+	}
+	b, err := encodeSession(ses)
+	if err != nil {
+		atomic.AddUint64(storeErrors[GOSESSION_STORE_SAVE], 1)
+		logLocked(GOSESSION_LOG_ERROR, "session store operation failed", "operation", GOSESSION_STORE_SAVE, "session", logKey(key, ""), "error", err)
+		return err
+	}
+	return storeSaveLocked(setingsSession.Store, string(key), b, ses.expiration)
+}
+
+// The loadStoreLocked(key) function reads the session from the store from the settings into memory, the block must be locked
+func loadStoreLocked(key SessionId) (internalSession, bool) {
+	if setingsSession.Store == nil {
+		return internalSession{}, false
+	}
+	b, err := storeLoadLocked(setingsSession.Store, string(key))
+	if err != nil {
+		return internalSession{}, false
+	}
+	ses, err := decodeSession(b)
+	if err != nil {
+		return internalSession{}, false
+	}
+	cacheLocked(key, ses)
+	indexUserLocked(key, ses.userId)
+	indexLinksLocked(key, ses.links)
+	return ses, true
+}
+
+// The cleaningStore(presently) function deletes expired sessions that are in the store but not in memory and returns their number
+func cleaningStore(presently int64) int {
+	store := setingsSession.Store
+	if store == nil {
+		return 0
+	}
+	removed := 0
+	cursor := ""
+	for {
+		keys, next, err := storeScan(store, cursor, GOSESSION_SCAN_PAGE)
+		if err != nil {
+			return removed
+		}
+		for _, key := range keys {
+			block.Lock()
+			if _, ok := allSessions[SessionId(key)]; !ok {
+				b, err := storeLoadLocked(store, key)
+				if err == ErrNotFound {
+					storeDeleteLocked(store, key)
+					unindexEvictedLocked(SessionId(key))
+				} else if err == nil {
+					ses, err := decodeSession(b)
+					if err == nil && ses.expiration < presently {
+						emitLocked(GOSESSION_EVENT_EXPIRE, SessionId(key), idOfKey(SessionId(key)), "", ses)
+					}
+					if err != nil || ses.expiration < presently {
+						storeDeleteLocked(store, key)
+						unindexEvictedLocked(SessionId(key))
+						removed++
+					}
+				}
+			}
+			unlockS()
+		}
+		if next == "" {
+			return removed
+		}
+		cursor = next
+	}
+}
+
+// The mergeScan(a, aNext, b, bNext, limit) function merges two pages of keys scanned from the same cursor
+// into one sorted page without duplicates and returns it with the cursor for the next call
+func mergeScan(a []string, aNext string, b []string, bNext string, limit int) ([]string, string) {
+	seen := make(map[string]struct{}, len(a)+len(b))
+	keys := make([]string, 0, len(a)+len(b))
+	for _, list := range [][]string{a, b} {
+		for _, key := range list {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		return keys[:limit], keys[limit-1]
+	}
+	if (aNext != "" || bNext != "") && len(keys) > 0 {
+		return keys, keys[len(keys)-1]
+	}
+	return keys, ""
+}
+
+// The MemoryStore type is a simple Store that keeps serialized sessions in memory.
+// It is useful for tests and as an example of implementing the Store interface.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+}
+
+// The memoryEntry type is one entry of the MemoryStore
+type memoryEntry struct {
+	data       []byte
+	expiration int64
+}
+
+// The NewMemoryStore() function creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// The Load(key) MemoryStore-method returns the serialized session or ErrNotFound
+func (ms *MemoryStore) Load(key string) ([]byte, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	e, ok := ms.entries[key]
+	if !ok || e.expiration < clockNow().Unix() {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), e.data...), nil
+}
+
+// The Save(key, data, expiration) MemoryStore-method writes the serialized session
+func (ms *MemoryStore) Save(key string, data []byte, expiration int64) error {
+	ms.mu.Lock()
+	ms.entries[key] = memoryEntry{data: append([]byte(nil), data...), expiration: expiration}
+	ms.mu.Unlock()
+	return nil
+}
+
+// The Delete(key) MemoryStore-method removes the entry
+func (ms *MemoryStore) Delete(key string) error {
+	ms.mu.Lock()
+	delete(ms.entries, key)
+	ms.mu.Unlock()
+	return nil
+}
+
+// The Scan(cursor, limit) MemoryStore-method returns the keys in sorted order starting after the cursor
+func (ms *MemoryStore) Scan(cursor string, limit int) ([]string, string, error) {
+	ms.mu.RLock()
+	keys := make([]string, 0, len(ms.entries))
+	for key := range ms.entries {
+		if key > cursor {
+			keys = append(keys, key)
+		}
+	}
+	ms.mu.RUnlock()
+	sort.Strings(keys)
+	if limit <= 0 || len(keys) <= limit {
+		return keys, "", nil
+	}
+	return keys[:limit], keys[limit-1], nil
+}
+
+// The Len() MemoryStore-method returns the number of entries in the store
+func (ms *MemoryStore) Len() int {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return len(ms.entries)
+}
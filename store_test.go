@@ -0,0 +1,215 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// The useTestStore(t, store) function sets the store in the settings until the end of the test
+func useTestStore(t *testing.T, store Store) {
+	old := setingsSession
+	withStore := setingsSession
+	withStore.Store = store
+	SetSetings(withStore)
+	t.Cleanup(func() {
+		SetSetings(old)
+	})
+}
+
+// The unregisteredValue type is the value of a session variable that is not registered with gob.Register()
+type unregisteredValue struct {
+	N int
+}
+
+// The restartMemory(ids) function forgets the sessions in memory and in the indexes as a restart does, the store keeps them
+func restartMemory(ids []SessionId) {
+	block.Lock()
+	for _, id := range ids {
+		key := id.key()
+		if ses, ok := allSessions[key]; ok {
+			unindexUserLocked(key, ses.userId)
+			unindexLinksLocked(key, ses.links)
+			unindexHandleLocked(key)
+			memoryBytes -= ses.size
+			delete(allSessions, key)
+		}
+		unindexEvictedLocked(key)
+	}
+	unlockS()
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_encodeSession(t *testing.T) {
+	ses := internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       Session{"name": "value", "count": 10},
+		csrf:       generateCSRF(),
+		flashes:    []Flash{{Kind: GOSESSION_FLASH_INFO, Message: "message"}},
+		userId:     "user",
+		authTimes:  map[AuthLevel]int64{GOSESSION_AUTH_PASSWORD: 1},
+		ip:         "127.0.0.1",
+	}
+
+	b, err := encodeSession(ses) // calling the tested function
+	// work check
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := decodeSession(b) // calling the tested function
+	// work check
+	if err != nil {
+		t.Fatal(err)
+	}
+	// work check
+	if res.expiration != ses.expiration || res.data["name"] != "value" || res.data["count"] != 10 ||
+		string(res.csrf) != string(ses.csrf) || len(res.flashes) != 1 || res.userId != "user" ||
+		res.authTimes[GOSESSION_AUTH_PASSWORD] != 1 || res.ip != "127.0.0.1" {
+		t.Errorf("The decoded session is not equal: %+v", res)
+	}
+
+	// work check
+	if _, err := decodeSession([]byte("bad data")); err == nil { // calling the tested function
+		t.Error("Damaged data was decoded.")
+	}
+}
+
+func Test_MemoryStore(t *testing.T) {
+	ms := NewMemoryStore()
+	for i := 0; i < GOSESSION_TESTING_ITER; i++ {
+		ms.Save(fmt.Sprintf("key%03d", i), []byte("data"), time.Now().Unix()+60) // calling the tested function
+	}
+	ms.Save("expired", []byte("data"), 0)
+
+	// work check
+	if b, err := ms.Load("key001"); err != nil || string(b) != "data" { // calling the tested function
+		t.Error("Failed to load the entry.")
+	}
+	// work check
+	if _, err := ms.Load("expired"); err != ErrNotFound { // calling the tested function
+		t.Error("The expired entry was loaded.")
+	}
+
+	count := 0
+	cursor := ""
+	for {
+		keys, next, err := ms.Scan(cursor, 7) // calling the tested function
+		if err != nil {
+			t.Fatal(err)
+		}
+		count += len(keys)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	// work check
+	if count != GOSESSION_TESTING_ITER+1 {
+		t.Errorf("Incorrect number of scanned keys: %d", count)
+	}
+
+	ms.Delete("key001") // calling the tested function
+	// work check
+	if _, err := ms.Load("key001"); err != ErrNotFound || ms.Len() != GOSESSION_TESTING_ITER {
+		t.Error("Failed to delete the entry.")
+	}
+}
+
+func Test_Store(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+
+	var id SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = Start(&w, r)
+		id.Set("name", "value")
+		id, _ = id.Login(&w, "store user")
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// work check
+	if _, err := ms.Load(string(id.key())); err != nil {
+		t.Error("The session was not written to the store.")
+	}
+
+	// the session is loaded from the store after a restart
+	restartMemory([]SessionId{id})
+	// work check
+	if id.Get("name") != "value" || !id.IsAuthenticated() || len(UserSessions("store user")) != 1 {
+		t.Error("The session was not loaded from the store.")
+	}
+
+	var w http.ResponseWriter = httptest.NewRecorder()
+	id.Destroy(&w)
+	// work check
+	if _, err := ms.Load(string(id.key())); err != ErrNotFound {
+		t.Error("The session was not deleted from the store.")
+	}
+}
+
+func Test_saveStoreLocked(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+	tl := useTestLogger(t, false)
+	id := startTestSession()
+	defer id.destroyS()
+	id.Set("name", "value")
+	failed := Metrics().StoreErrors[GOSESSION_STORE_SAVE]
+
+	err := id.Set("bad", unregisteredValue{N: 1}) // calling the tested function
+	// work check
+	if err == nil || id.Get("bad") != nil || id.Get("name") != "value" {
+		t.Errorf("The value that cannot be stored was set: %v", err)
+	}
+	b, _ := ms.Load(string(id.key()))
+	ses, _ := decodeSession(b)
+	// work check
+	if ses.data["name"] != "value" {
+		t.Error("The store lost the previous version of the session.")
+	}
+	record, ok := tl.find("session store operation failed")
+	// work check
+	if Metrics().StoreErrors[GOSESSION_STORE_SAVE] != failed+1 || !ok || record.value("operation") != GOSESSION_STORE_SAVE {
+		t.Errorf("The failure was not counted or logged: %v %v", Metrics().StoreErrors[GOSESSION_STORE_SAVE]-failed, record)
+	}
+}
+
+func Test_cleaningStore(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+
+	live, _ := encodeSession(internalSession{expiration: time.Now().Unix() + 60})
+	expired, _ := encodeSession(internalSession{expiration: time.Now().Unix() - 60})
+	ms.Save("live", live, time.Now().Unix()+60)
+	ms.Save("expired", expired, time.Now().Unix()+60)
+	ms.Save("damaged", []byte("bad data"), time.Now().Unix()+60)
+
+	cleaningStore(time.Now().Unix()) // calling the tested function
+	// work check
+	if ms.Len() != 1 {
+		t.Errorf("Incorrect number of entries after cleaning: %d", ms.Len())
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_encodeSession(b *testing.B) {
+	ses := internalSession{
+		expiration: time.Now().Unix() + setingsSession.Expiration,
+		data:       Session{"name": "value"},
+	}
+	for i := 0; i < b.N; i++ {
+		encodeSession(ses) // calling the tested function
+	}
+}
@@ -0,0 +1,205 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Names of the spans started by GoSession
+const (
+	GOSESSION_SPAN_START        string = "gosession.Start"  // Start() and StartSecure()
+	GOSESSION_SPAN_COMMIT       string = "gosession.commit" // Writing the changed session to memory and to the store
+	GOSESSION_SPAN_STORE_PREFIX string = "gosession.store." // Operations of the persistent store, followed by the operation name
+	GOSESSION_TIMING_LOAD       string = "session-load"     // Metric of the Server-Timing header with the time of reading the session
+	GOSESSION_TIMING_SAVE       string = "session-save"     // Metric of the Server-Timing header with the time of writing the session
+)
+
+// The Span interface is the traced operation
+type Span interface {
+	// SetAttribute adds the attribute of the operation
+	SetAttribute(key string, value interface{})
+	// End finishes the operation, err is nil if it succeeded
+	End(err error)
+}
+
+// The Tracer interface starts the spans, it can be implemented on top of OpenTelemetry or another tracing library.
+// The spans of Start() and of the operations it makes are children of the request context,
+// the spans of the operations outside of Start() are started with context.Background().
+// The spans of the operations made under the internal lock are reported after the lock is released, see SpanRecorder.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// The SpanRecorder interface may be implemented by the Tracer to receive the spans of the operations made under the internal lock
+// with their real start and end time. These spans are reported after the lock is released, so that a slow tracer does not stall the sessions,
+// a Tracer without RecordSpan() gets them through StartSpan() at that moment with the "duration" attribute.
+type SpanRecorder interface {
+	RecordSpan(ctx context.Context, name string, start time.Time, end time.Time, attrs map[string]interface{}, err error)
+}
+
+// The noopSpan type is the Span used when there is no tracer in the settings
+type noopSpan struct{}
+
+// The SetAttribute(key, value) noopSpan-method does nothing
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+
+// The End(err) noopSpan-method does nothing
+func (noopSpan) End(err error) {}
+
+// The startSpan(ctx, name, attrs) function starts the span with the tracer from the settings, if any.
+// attrs - alternating keys and values of the attributes.
+func startSpan(ctx context.Context, name string, attrs ...interface{}) (context.Context, Span) {
+	tracer := setingsSession.Tracer
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+	ctx, span := tracer.StartSpan(ctx, name)
+	setAttributes(span, attrs)
+	return ctx, span
+}
+
+// The setAttributes(span, attrs) function adds the alternating keys and values of the attributes to the span
+func setAttributes(span Span, attrs []interface{}) {
+	for i := 0; i+1 < len(attrs); i += 2 {
+		span.SetAttribute(fmt.Sprint(attrs[i]), attrs[i+1])
+	}
+}
+
+// The opSpan type is the span of an internal operation. The span of an operation made under the block is only recorded,
+// it is reported by unlockS() after the block is released.
+type opSpan struct {
+	span   Span            // The started span, nil if the span is recorded
+	tracer Tracer          // The tracer of the recorded span
+	ctx    context.Context // The parent context of the recorded span
+	name   string
+	attrs  []interface{}
+	start  time.Time
+}
+
+// The beginSpan(locked, name, attrs) function starts the span of the operation or, if the block is locked, begins its record.
+// The parent of a recorded span is the context of the request the block is locked for, see lockS().
+// locked - the block is locked.
+// attrs - alternating keys and values of the attributes.
+func beginSpan(locked bool, name string, attrs ...interface{}) opSpan {
+	tracer := setingsSession.Tracer
+	if tracer == nil {
+		return opSpan{span: noopSpan{}}
+	}
+	if !locked {
+		_, span := startSpan(context.Background(), name, attrs...)
+		return opSpan{span: span}
+	}
+	ctx := lockedCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return opSpan{tracer: tracer, ctx: ctx, name: name, attrs: attrs, start: time.Now()}
+}
+
+// The end(err) opSpan-method finishes the span or queues the record of the span for unlockS(), err is nil if the operation succeeded
+func (ops opSpan) end(err error) {
+	if ops.span != nil {
+		ops.span.End(err)
+		return
+	}
+	end := time.Now()
+	queueLocked(func() {
+		ops.report(end, err)
+	})
+}
+
+// The report(end, err) opSpan-method passes the recorded span to the tracer
+func (ops opSpan) report(end time.Time, err error) {
+	if sr, ok := ops.tracer.(SpanRecorder); ok {
+		attrs := make(map[string]interface{}, len(ops.attrs)/2)
+		for i := 0; i+1 < len(ops.attrs); i += 2 {
+			attrs[fmt.Sprint(ops.attrs[i])] = ops.attrs[i+1]
+		}
+		sr.RecordSpan(ops.ctx, ops.name, ops.start, end, attrs, err)
+		return
+	}
+	_, span := ops.tracer.StartSpan(ops.ctx, ops.name)
+	setAttributes(span, ops.attrs)
+	span.SetAttribute("duration", end.Sub(ops.start))
+	span.End(err)
+}
+
+// The traceStore(locked, op, key) function starts the span of the store operation.
+// locked - the block is locked.
+func traceStore(locked bool, op string, key string) opSpan {
+	if setingsSession.Tracer == nil {
+		return opSpan{span: noopSpan{}}
+	}
+	return beginSpan(locked, GOSESSION_SPAN_STORE_PREFIX+op, "session", logKey(SessionId(key), ""))
+}
+
+// The endStoreSpan(span, err) function finishes the span of the store operation, a missing entry is not an error
+func endStoreSpan(span opSpan, err error) {
+	if err == ErrNotFound {
+		err = nil
+	}
+	span.end(err)
+}
+
+// The traceCommitLocked(key) function starts the span of writing the session, the block must be locked
+func traceCommitLocked(key SessionId) opSpan {
+	if setingsSession.Tracer == nil {
+		return opSpan{span: noopSpan{}}
+	}
+	return beginSpan(true, GOSESSION_SPAN_COMMIT, "session", logKey(key, ""))
+}
+
+// The requestTrace type traces Start() and StartSecure() and counts the time spent reading and writing the session
+type requestTrace struct {
+	ctx  context.Context // The context of the span, the parent of the spans of the operations
+	span Span
+	load time.Duration
+	save time.Duration
+}
+
+// The startTrace(r, secure) function starts tracing of Start() or StartSecure()
+func startTrace(r *http.Request, secure bool) *requestTrace {
+	ctx, span := startSpan(r.Context(), GOSESSION_SPAN_START, "secure", secure)
+	return &requestTrace{ctx: ctx, span: span}
+}
+
+// The read(id) requestTrace-method reads the session and counts the time
+func (rt *requestTrace) read(id SessionId) (internalSession, bool) {
+	start := time.Now()
+	ses, ok := id.readCtxS(rt.ctx)
+	rt.load += time.Since(start)
+	rt.span.SetAttribute("session", logKey(id.key(), id))
+	rt.span.SetAttribute("found", ok)
+	return ses, ok
+}
+
+// The write(id, ses) requestTrace-method writes the session and counts the time
+func (rt *requestTrace) write(id SessionId, ses internalSession) {
+	start := time.Now()
+	id.writeCtxS(rt.ctx, ses)
+	rt.save += time.Since(start)
+}
+
+// The drop(id) requestTrace-method deletes the session without the destroy event and counts the time
+func (rt *requestTrace) drop(id SessionId) {
+	start := time.Now()
+	id.dropCtxS(rt.ctx)
+	rt.save += time.Since(start)
+}
+
+// The end(w) requestTrace-method finishes the span and sends the Server-Timing header if it is enabled in the settings
+func (rt *requestTrace) end(w *http.ResponseWriter) {
+	rt.span.End(nil)
+	if !setingsSession.ServerTiming {
+		return
+	}
+	(*w).Header().Add("Server-Timing", fmt.Sprintf("%s;dur=%.3f, %s;dur=%.3f",
+		GOSESSION_TIMING_LOAD, float64(rt.load)/float64(time.Millisecond),
+		GOSESSION_TIMING_SAVE, float64(rt.save)/float64(time.Millisecond)))
+}
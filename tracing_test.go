@@ -0,0 +1,246 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The testSpan type is the Span that saves its attributes
+type testSpan struct {
+	tracer *testTracer
+	name   string
+	parent interface{}
+	attrs  map[string]interface{}
+	ended  bool
+}
+
+// The testTracer type is the Tracer that saves the finished spans
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+// The testParentKey type is the key of the parent value in the context
+type testParentKey struct{}
+
+// The StartSpan(ctx, name) testTracer-method starts the span, the name of the span is the parent value of the returned context
+func (tt *testTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	span := &testSpan{tracer: tt, name: name, parent: ctx.Value(testParentKey{}), attrs: make(map[string]interface{})}
+	return context.WithValue(ctx, testParentKey{}, name), span
+}
+
+// The SetAttribute(key, value) testSpan-method saves the attribute
+func (ts *testSpan) SetAttribute(key string, value interface{}) {
+	ts.attrs[key] = value
+}
+
+// The End(err) testSpan-method saves the finished span
+func (ts *testSpan) End(err error) {
+	ts.ended = true
+	ts.tracer.mu.Lock()
+	ts.tracer.spans = append(ts.tracer.spans, ts)
+	ts.tracer.mu.Unlock()
+}
+
+// The names() testTracer-method returns the names of the finished spans and forgets them
+func (tt *testTracer) names() map[string]int {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	res := make(map[string]int)
+	for _, span := range tt.spans {
+		res[span.name]++
+	}
+	tt.spans = nil
+	return res
+}
+
+// The useTestTracer(t, serverTiming) function sets the recording tracer in the settings until the end of the test
+func useTestTracer(t *testing.T, serverTiming bool) *testTracer {
+	tt := &testTracer{}
+	old := setingsSession
+	withTracer := setingsSession
+	withTracer.Tracer = tt
+	withTracer.ServerTiming = serverTiming
+	SetSetings(withTracer)
+	t.Cleanup(func() {
+		SetSetings(old)
+	})
+	return tt
+}
+
+// The recordingTracer type is the testTracer that receives the spans made under the block through RecordSpan()
+// and counts the calls made while the block is held
+type recordingTracer struct {
+	testTracer
+	locked int32
+}
+
+// The RecordSpan(ctx, name, start, end, attrs, err) recordingTracer-method saves the recorded span
+func (rt *recordingTracer) RecordSpan(ctx context.Context, name string, start time.Time, end time.Time, attrs map[string]interface{}, err error) {
+	if !blockFree() {
+		atomic.AddInt32(&rt.locked, 1)
+	}
+	attrs["duration"] = end.Sub(start)
+	span := &testSpan{tracer: &rt.testTracer, name: name, parent: ctx.Value(testParentKey{}), attrs: attrs}
+	span.End(err)
+}
+
+// The checkingLogger type is the Logger that counts the records passed while the block is held
+type checkingLogger struct {
+	records int32
+	locked  int32
+}
+
+// The Log(level, msg, keyvals) checkingLogger-method counts the record
+func (cl *checkingLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	atomic.AddInt32(&cl.records, 1)
+	if !blockFree() {
+		atomic.AddInt32(&cl.locked, 1)
+	}
+}
+
+// The blockFree() function reports whether the block can be locked by another goroutine
+func blockFree() bool {
+	done := make(chan struct{})
+	go func() {
+		block.Lock()
+		block.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_tracing(t *testing.T) {
+	tt := useTestTracer(t, false)
+	useTestStore(t, NewMemoryStore())
+
+	var id SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = Start(&w, r)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), testParentKey{}, "request span"))
+	handler(httptest.NewRecorder(), r) // calling the tested function
+
+	tt.mu.Lock()
+	var start *testSpan
+	for _, span := range tt.spans {
+		if span.name == GOSESSION_SPAN_START {
+			start = span
+		}
+	}
+	tt.mu.Unlock()
+	// work check
+	if start == nil || start.parent != "request span" || start.attrs["found"] != false || start.attrs["session"] != logKey(id.key(), id) {
+		t.Fatalf("Incorrect span of Start: %+v", start)
+	}
+	tt.mu.Lock()
+	for _, span := range tt.spans {
+		// work check
+		if span.name != GOSESSION_SPAN_START && (span.parent != GOSESSION_SPAN_START || span.attrs["duration"] == nil) {
+			t.Errorf("The span is not a child of the span of Start: %+v", span)
+		}
+	}
+	tt.mu.Unlock()
+	names := tt.names()
+	// work check
+	if names[GOSESSION_SPAN_COMMIT] != 1 || names[GOSESSION_SPAN_STORE_PREFIX+GOSESSION_STORE_SAVE] != 1 || names[GOSESSION_SPAN_STORE_PREFIX+GOSESSION_STORE_LOAD] != 1 {
+		t.Errorf("Incorrect spans: %v", names)
+	}
+
+	id.Set("name", "value") // calling the tested function
+	// work check
+	if names := tt.names(); names[GOSESSION_SPAN_COMMIT] != 1 || names[GOSESSION_SPAN_STORE_PREFIX+GOSESSION_STORE_SAVE] != 1 {
+		t.Errorf("Incorrect spans of Set: %v", names)
+	}
+	id.destroyS()
+}
+
+func Test_tracing_unlocked(t *testing.T) {
+	rt := &recordingTracer{}
+	cl := &checkingLogger{}
+	old := setingsSession
+	setings := setingsSession
+	setings.Tracer = rt
+	setings.Logger = cl
+	setings.Store = &failingStore{MemoryStore: NewMemoryStore()}
+	SetSetings(setings)
+	t.Cleanup(func() {
+		SetSetings(old)
+	})
+
+	var id SessionId
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = Start(&w, r)
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)) // calling the tested function
+	id.destroyS()
+	names := rt.names()
+	// work check
+	if names[GOSESSION_SPAN_COMMIT] != 1 || names[GOSESSION_SPAN_STORE_PREFIX+GOSESSION_STORE_SAVE] != 1 || atomic.LoadInt32(&cl.records) < 3 {
+		t.Errorf("The spans or the records were lost: %v %v", names, cl.records)
+	}
+	// work check
+	if atomic.LoadInt32(&rt.locked) != 0 || atomic.LoadInt32(&cl.locked) != 0 {
+		t.Errorf("The tracer or the logger was called under the block: %v %v", rt.locked, cl.locked)
+	}
+}
+
+func Test_ServerTiming(t *testing.T) {
+	useTestTracer(t, true)
+	w := httptest.NewRecorder()
+	var id SessionId
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		id = StartSecure(&rw, r)
+	}
+	handler(w, httptest.NewRequest("GET", "/", nil)) // calling the tested function
+	header := w.Header().Get("Server-Timing")
+	// work check
+	if !regexp.MustCompile(`^session-load;dur=\d+\.\d{3}, session-save;dur=\d+\.\d{3}$`).MatchString(header) {
+		t.Errorf("Incorrect Server-Timing header: %q", header)
+	}
+	id.destroyS()
+
+	SetSetings(GoSessionSetings{
+		CookieName:    setingsSession.CookieName,
+		Expiration:    setingsSession.Expiration,
+		TimerCleaning: setingsSession.TimerCleaning,
+	})
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/", nil)) // calling the tested function
+	// work check
+	if w.Header().Get("Server-Timing") != "" {
+		t.Error("The header was sent without the setting.")
+	}
+	id.destroyS()
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_startSpan(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, span := startSpan(context.Background(), GOSESSION_SPAN_COMMIT, "session", "key") // calling the tested function
+		span.End(nil)
+	}
+}
@@ -0,0 +1,87 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"time"
+)
+
+// The withDeadline(name, deadline) internalSession-method returns the session with the new deadline of the variable.
+// The map of deadlines is copied, so the sessions read earlier are not changed.
+// deadline - UnixNano time, 0 - the variable has no deadline.
+func (ses internalSession) withDeadline(name string, deadline int64) internalSession {
+	if _, ok := ses.deadlines[name]; !ok && deadline == 0 {
+		return ses
+	}
+	deadlines := make(map[string]int64, len(ses.deadlines)+1)
+	for k, v := range ses.deadlines {
+		deadlines[k] = v
+	}
+	if deadline == 0 {
+		delete(deadlines, name)
+	} else {
+		deadlines[name] = deadline
+	}
+	if len(deadlines) == 0 {
+		deadlines = nil
+	}
+	ses.deadlines = deadlines
+	return ses
+}
+
+// The expiredVar(name, now) internalSession-method reports whether the deadline of the variable has passed
+func (ses internalSession) expiredVar(name string, now int64) bool {
+	deadline, ok := ses.deadlines[name]
+	return ok && deadline <= now
+}
+
+// The hasExpiredVars(now) internalSession-method reports whether the session has variables with a passed deadline
+func (ses internalSession) hasExpiredVars(now int64) bool {
+	for _, deadline := range ses.deadlines {
+		if deadline <= now {
+			return true
+		}
+	}
+	return false
+}
+
+// The liveData(now) internalSession-method returns the variables of the session without the expired ones
+func (ses internalSession) liveData(now int64) Session {
+	if !ses.hasExpiredVars(now) {
+		return ses.data
+	}
+	data := make(Session, len(ses.data))
+	for k, v := range ses.data {
+		if !ses.expiredVar(k, now) {
+			data[k] = v
+		}
+	}
+	return data
+}
+
+// The withoutExpiredVars(now) internalSession-method returns the session with the expired variables removed
+func (ses internalSession) withoutExpiredVars(now int64) internalSession {
+	ses.data = ses.liveData(now)
+	deadlines := make(map[string]int64, len(ses.deadlines))
+	for k, v := range ses.deadlines {
+		if v > now {
+			deadlines[k] = v
+		}
+	}
+	if len(deadlines) == 0 {
+		deadlines = nil
+	}
+	ses.deadlines = deadlines
+	return ses
+}
+
+// The SetWithTTL(name, value, ttl) SessionId-method sets the client variable that is removed from the session after the ttl,
+// for example a one-time verification code. After the deadline Get() returns nil, and the variable is deleted by the cleaner.
+// name - session variable name.
+// value - directly variable in session.
+// ttl - lifetime of the variable, it does not prolong the session.
+func (id SessionId) SetWithTTL(name string, value interface{}, ttl time.Duration) error {
+	return id.setS(name, value, clockNow().Add(ttl).UnixNano())
+}
@@ -0,0 +1,112 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"testing"
+	"time"
+)
+
+// --------------
+// Test functions
+// --------------
+
+func Test_withDeadline(t *testing.T) {
+	ses := internalSession{data: Session{"code": "1234"}}
+
+	withTTL := ses.withDeadline("code", 100) // calling the tested function
+	// work check
+	if withTTL.deadlines["code"] != 100 || ses.deadlines != nil {
+		t.Error("Incorrect setting of the deadline.")
+	}
+
+	withoutTTL := withTTL.withDeadline("code", 0) // calling the tested function
+	// work check
+	if withoutTTL.deadlines != nil || withTTL.deadlines["code"] != 100 {
+		t.Error("Incorrect removing of the deadline.")
+	}
+}
+
+func Test_withoutExpiredVars(t *testing.T) {
+	ses := internalSession{
+		data:      Session{"code": "1234", "state": "xyz", "name": "value"},
+		deadlines: map[string]int64{"code": 10, "state": 30},
+	}
+
+	res := ses.withoutExpiredVars(20) // calling the tested function
+	// work check
+	if len(res.data) != 2 || res.data["code"] != nil || len(res.deadlines) != 1 {
+		t.Errorf("Incorrect cleaning of variables: %v", res.data)
+	}
+	// work check
+	if len(ses.data) != 3 {
+		t.Error("The original session was changed.")
+	}
+}
+
+func Test_SetWithTTL(t *testing.T) {
+	id := startTestSession()
+
+	id.SetWithTTL("code", "1234", time.Hour) // calling the tested function
+	// work check
+	if id.Get("code") != "1234" {
+		t.Error("The variable was not set.")
+	}
+
+	id.SetWithTTL("code", "1234", -time.Second) // calling the tested function
+	// work check
+	if id.Get("code") != nil || id.GetAll()["code"] != nil {
+		t.Error("The expired variable is still visible.")
+	}
+
+	// the usual Set removes the deadline
+	id.Set("code", "5678")
+	// work check
+	if id.Get("code") != "5678" {
+		t.Error("The deadline was not removed by Set.")
+	}
+}
+
+func Test_SetWithTTL_cleaning(t *testing.T) {
+	ms := NewMemoryStore()
+	useTestStore(t, ms)
+	id := startTestSession()
+	id.SetWithTTL("code", "1234", -time.Second) // calling the tested function
+	id.Set("name", "value")
+
+	// the deadline is kept by the store
+	restartMemory([]SessionId{id})
+	// work check
+	if id.Get("code") != nil || id.Get("name") != "value" {
+		t.Error("The deadline was lost in the store.")
+	}
+
+	cleaningSessions()
+	ses, _ := id.readS()
+	// work check
+	if _, ok := ses.data["code"]; ok || ses.deadlines != nil {
+		t.Error("The expired variable was not deleted by the cleaner.")
+	}
+	b, _ := ms.Load(string(id.key()))
+	stored, _ := decodeSession(b)
+	// work check
+	if _, ok := stored.data["code"]; ok {
+		t.Error("The expired variable was not deleted from the store.")
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_liveData(b *testing.B) {
+	ses := internalSession{
+		data:      Session{"code": "1234", "name": "value"},
+		deadlines: map[string]int64{"code": time.Now().Add(time.Hour).UnixNano()},
+	}
+	for i := 0; i < b.N; i++ {
+		ses.liveData(time.Now().UnixNano()) // calling the tested function
+	}
+}
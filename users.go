@@ -0,0 +1,278 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+)
+
+// The SessionLimitPolicy type defines what happens when the user logs in with the maximum number of sessions
+type SessionLimitPolicy int
+
+const (
+	GOSESSION_LIMIT_REJECT       SessionLimitPolicy = iota // The new login is rejected
+	GOSESSION_LIMIT_EVICT_OLDEST                           // The session created earliest is deleted
+	GOSESSION_LIMIT_EVICT_LRU                              // The session used least recently is deleted
+)
+
+// The userSessions type is an index of session store keys by user identifier
+type userSessions map[string]map[SessionId]struct{}
+
+// The allUsers variable stores the sessions of each authenticated user, it is protected by the same block as allSessions
+var allUsers userSessions = make(userSessions, 0)
+
+// The allHandles variable stores the store keys of the sessions in memory by their public handles,
+// it is protected by the same block as allSessions
+var allHandles = make(map[string]SessionId)
+
+// The SessionInfo type describes one session of the user, for example for the "active devices" page
+type SessionInfo struct {
+	Handle     string    // Public handle of the session, safe to show to the client and to use for destroying the session
+	UserId     string    // Identifier of the authenticated user
+	Created    time.Time // Time of the session creation
+	LastSeen   time.Time // Time of the last request of the client
+	Expiration time.Time // Time when the session expires
+	IP         string    // IP address of the client from the last request
+	UserAgent  string    // User-Agent of the client from the last request
+	Current    bool      // The session is the one from which the list was requested
+}
+
+// The indexUserLocked(key, userId) function adds the session to the user index, the block must be locked
+func indexUserLocked(key SessionId, userId string) {
+	if userId == "" {
+		return
+	}
+	ids, ok := allUsers[userId]
+	if !ok {
+		ids = make(map[SessionId]struct{})
+		allUsers[userId] = ids
+	}
+	ids[key] = struct{}{}
+}
+
+// The unindexUserLocked(key, userId) function removes the session from the user index, the block must be locked
+func unindexUserLocked(key SessionId, userId string) {
+	ids, ok := allUsers[userId]
+	if !ok {
+		return
+	}
+	delete(ids, key)
+	if len(ids) == 0 {
+		delete(allUsers, userId)
+	}
+}
+
+// The indexHandleLocked(key) function adds the session put in memory to the handle index, the block must be locked
+func indexHandleLocked(key SessionId) {
+	if _, ok := allSessions[key]; !ok {
+		allHandles[key.handle()] = key
+	}
+}
+
+// The unindexHandleLocked(key) function removes the session removed from memory from the handle index, the block must be locked
+func unindexHandleLocked(key SessionId) {
+	if _, ok := allSessions[key]; ok {
+		delete(allHandles, key.handle())
+	}
+}
+
+// The handle() SessionId-method returns a short non-reversible public handle of the session by its store key
+func (key SessionId) handle() string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// The HandleOf(key) function returns the public handle of the session by its key in the persistent store,
+// for tools that work with the store directly
+func HandleOf(key string) string {
+	return SessionId(key).handle()
+}
+
+// The info(key, current) internalSession-method converts the session into its public description.
+// key, current - store keys of the session and of the session from which the description is requested.
+func (ses internalSession) info(key SessionId, current SessionId) SessionInfo {
+	return SessionInfo{
+		Handle:     key.handle(),
+		UserId:     ses.userId,
+		Created:    time.Unix(ses.created, 0),
+		LastSeen:   time.Unix(ses.lastSeen, 0),
+		Expiration: time.Unix(ses.expiration, 0),
+		IP:         ses.ip,
+		UserAgent:  ses.userAgent,
+		Current:    key == current,
+	}
+}
+
+// The limitUserLocked(userId, current) function checks the limit of sessions of the user before login, the block must be locked.
+// Depending on the policy, it returns an error or deletes the extra sessions and returns their descriptions.
+// The sessions that are only in the persistent store are counted if they were indexed by indexStoredUserS() before.
+// current - store key of the session in which the user logs in, it is not counted.
+func limitUserLocked(userId string, current SessionId) ([]SessionInfo, error) {
+	limit := setingsAuth.MaxSessionsPerUser
+	if limit <= 0 || userId == "" {
+		return nil, nil
+	}
+	presently := clockNow().Unix()
+	live := make([]SessionInfo, 0, len(allUsers[userId]))
+	ids := make(map[string]SessionId, len(allUsers[userId]))
+	for key := range allUsers[userId] {
+		if ses, ok := indexedLocked(key); ok && key != current && ses.expiration >= presently {
+			info := ses.info(key, current)
+			live = append(live, info)
+			ids[info.Handle] = key
+		}
+	}
+	if len(live) < limit {
+		return nil, nil
+	}
+	switch setingsAuth.LimitPolicy {
+	case GOSESSION_LIMIT_EVICT_OLDEST:
+		sort.Slice(live, func(i, j int) bool {
+			return live[i].Created.Before(live[j].Created)
+		})
+	case GOSESSION_LIMIT_EVICT_LRU:
+		sort.Slice(live, func(i, j int) bool {
+			return live[i].LastSeen.Before(live[j].LastSeen)
+		})
+	default:
+		return nil, ErrTooManySessions
+	}
+	evicted := live[:len(live)-limit+1]
+	for _, info := range evicted {
+		destroyLocked(ids[info.Handle], idOfKey(ids[info.Handle]))
+	}
+	return evicted, nil
+}
+
+// The indexStoredUserS(userId) function safely finds the sessions of the user that are only in the persistent store by scanning it
+// and adds them to the user index, so that they are listed, counted and destroyed like the sessions in memory.
+// After a restart the index is empty, the sessions of the store get there only when they are read or found by this function.
+func indexStoredUserS(userId string) {
+	store := setingsSession.Store
+	if store == nil || userId == "" {
+		return
+	}
+	cursor := ""
+	for {
+		keys, next, err := storeScan(store, cursor, GOSESSION_SCAN_PAGE)
+		if err != nil {
+			return
+		}
+		for _, key := range keys {
+			block.RLock()
+			_, cached := allSessions[SessionId(key)]
+			_, indexed := evictedSessions[SessionId(key)]
+			block.RUnlock()
+			if cached || indexed {
+				continue
+			}
+			b, err := storeLoad(store, key)
+			if err != nil {
+				continue
+			}
+			if ses, err := decodeSession(b); err == nil && ses.userId == userId {
+				block.Lock()
+				indexStoredLocked(SessionId(key), ses)
+				unlockS()
+			}
+		}
+		if next == "" {
+			return
+		}
+		cursor = next
+	}
+}
+
+// The userSessionsS(userId, current) function safely gets the descriptions of the live sessions of the user, the most recently used first.
+// current - store key of the session to be marked as current.
+func userSessionsS(userId string, current SessionId) []SessionInfo {
+	indexStoredUserS(userId)
+	presently := clockNow().Unix()
+	block.Lock()
+	res := make([]SessionInfo, 0, len(allUsers[userId]))
+	for key := range allUsers[userId] {
+		if ses, ok := indexedLocked(key); ok && ses.expiration >= presently {
+			res = append(res, ses.info(key, current))
+		}
+	}
+	unlockS()
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LastSeen.After(res[j].LastSeen)
+	})
+	return res
+}
+
+// The destroyUserS(userId, keep, handle) function safely deletes the sessions of the user.
+// keep - store key of the session that must not be deleted.
+// handle - if not empty, only the session with this public handle is deleted.
+func destroyUserS(userId string, keep SessionId, handle string) int {
+	indexStoredUserS(userId)
+	count := 0
+	block.Lock()
+	for key := range allUsers[userId] {
+		if key == keep || (handle != "" && key.handle() != handle) {
+			continue
+		}
+		destroyLocked(key, idOfKey(key))
+		count++
+	}
+	unlockS()
+	return count
+}
+
+// The UserSessions(userId) function returns the live sessions of the user, the most recently used first.
+// userId - identifier of the user.
+func UserSessions(userId string) []SessionInfo {
+	return userSessionsS(userId, "")
+}
+
+// The DestroyUserSessions(userId) function deletes all sessions of the user ("sign out everywhere") and returns their number.
+// userId - identifier of the user.
+func DestroyUserSessions(userId string) int {
+	if userId == "" {
+		return 0
+	}
+	return destroyUserS(userId, "", "")
+}
+
+// The Info() SessionId-method returns the description of the session
+func (id SessionId) Info() (SessionInfo, bool) {
+	ses, ok := id.readS()
+	if !ok {
+		return SessionInfo{}, false
+	}
+	return ses.info(id.key(), id.key()), true
+}
+
+// The Sessions() SessionId-method returns all live sessions of the user logged in to this session, the current one is marked
+func (id SessionId) Sessions() []SessionInfo {
+	userId := id.UserId()
+	if userId == "" {
+		return []SessionInfo{}
+	}
+	return userSessionsS(userId, id.key())
+}
+
+// The DestroyOtherSessions() SessionId-method deletes all sessions of the user logged in to this session, except this one, and returns their number
+func (id SessionId) DestroyOtherSessions() int {
+	userId := id.UserId()
+	if userId == "" {
+		return 0
+	}
+	return destroyUserS(userId, id.key(), "")
+}
+
+// The DestroySession(handle) SessionId-method deletes another session of the same user by its public handle from SessionInfo.
+// The current session cannot be deleted in this way, use Destroy() or Logout() for it.
+func (id SessionId) DestroySession(handle string) bool {
+	userId := id.UserId()
+	if userId == "" || handle == "" {
+		return false
+	}
+	return destroyUserS(userId, id.key(), handle) > 0
+}
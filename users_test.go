@@ -0,0 +1,284 @@
+package gosession
+
+// --------------------------------------------------------
+// Copyright (c) 2022 Constantine Zavezeon <kwynto@mail.ru>
+// --------------------------------------------------------
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// The loginTestUser(userId, count) function creates several sessions of one user from different devices
+func loginTestUser(userId string, count int) []SessionId {
+	res := make([]SessionId, 0, count)
+	for i := 0; i < count; i++ {
+		var id SessionId
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			id = Start(&w, r)
+			id, _ = id.Login(&w, userId)
+		}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", "test agent")
+		handler(httptest.NewRecorder(), r)
+		res = append(res, id)
+	}
+	return res
+}
+
+// --------------
+// Test functions
+// --------------
+
+func Test_indexUserLocked(t *testing.T) {
+	id := generateId()
+	userId := string(generateId())
+
+	block.Lock()
+	indexUserLocked(id, userId) // calling the tested function
+	_, ok := allUsers[userId][id]
+	block.Unlock()
+	// work check
+	if !ok {
+		t.Error("The session was not added to the index.")
+	}
+
+	block.Lock()
+	unindexUserLocked(id, userId) // calling the tested function
+	_, ok = allUsers[userId]
+	block.Unlock()
+	// work check
+	if ok {
+		t.Error("The empty index of the user was not deleted.")
+	}
+}
+
+func Test_UserSessions(t *testing.T) {
+	userId := string(generateId())
+	ids := loginTestUser(userId, 3)
+
+	list := UserSessions(userId) // calling the tested function
+	// work check
+	if len(list) != 3 {
+		t.Fatalf("Incorrect number of sessions: %d", len(list))
+	}
+	for _, v := range list {
+		// work check
+		if v.UserId != userId || v.UserAgent != "test agent" || v.IP == "" || v.Created.IsZero() || v.Current {
+			t.Errorf("Incorrect session description: %+v", v)
+		}
+	}
+
+	// expired sessions are not listed
+	ids[0].updateS(func(ses *internalSession) {
+		ses.expiration = 0
+	})
+	// work check
+	if len(UserSessions(userId)) != 2 { // calling the tested function
+		t.Error("The expired session was listed.")
+	}
+
+	// the index follows the logout
+	var w http.ResponseWriter = httptest.NewRecorder()
+	ids[1].Logout(&w)
+	// work check
+	if len(UserSessions(userId)) != 1 { // calling the tested function
+		t.Error("The session was listed after logout.")
+	}
+}
+
+func Test_DestroyUserSessions(t *testing.T) {
+	userId := string(generateId())
+	ids := loginTestUser(userId, 5)
+
+	count := DestroyUserSessions(userId) // calling the tested function
+	// work check
+	if count != 5 {
+		t.Errorf("Incorrect number of deleted sessions: %d", count)
+	}
+	for _, id := range ids {
+		// work check
+		if _, ok := id.readS(); ok {
+			t.Error("The session was not deleted.")
+		}
+	}
+}
+
+func Test_UserSessions_store(t *testing.T) {
+	useTestStore(t, NewMemoryStore())
+	userId := string(generateId())
+	ids := loginTestUser(userId, 2)
+	restartMemory(ids)
+
+	list := UserSessions(userId) // calling the tested function
+	// work check
+	if len(list) != 2 {
+		t.Errorf("The sessions of the store were not listed: %d", len(list))
+	}
+	count := DestroyUserSessions(userId) // calling the tested function
+	// work check
+	if count != 2 || ids[0].IsAuthenticated() || ids[1].GetAll() != nil {
+		t.Errorf("The sessions of the store were not destroyed: %d", count)
+	}
+}
+
+func Test_Sessions(t *testing.T) {
+	userId := string(generateId())
+	ids := loginTestUser(userId, 2)
+
+	list := ids[0].Sessions() // calling the tested function
+	current := 0
+	for _, v := range list {
+		if v.Current {
+			current++
+		}
+	}
+	// work check
+	if len(list) != 2 || current != 1 {
+		t.Error("Incorrect list of sessions.")
+	}
+
+	// work check
+	if len(generateId().Sessions()) != 0 { // calling the tested function
+		t.Error("Sessions were listed for an anonymous session.")
+	}
+}
+
+func Test_DestroyOtherSessions(t *testing.T) {
+	userId := string(generateId())
+	ids := loginTestUser(userId, 4)
+
+	count := ids[0].DestroyOtherSessions() // calling the tested function
+	// work check
+	if count != 3 {
+		t.Errorf("Incorrect number of deleted sessions: %d", count)
+	}
+	// work check
+	if !ids[0].IsAuthenticated() || len(UserSessions(userId)) != 1 {
+		t.Error("The current session was deleted.")
+	}
+}
+
+func Test_DestroySession(t *testing.T) {
+	userId := string(generateId())
+	ids := loginTestUser(userId, 2)
+
+	// work check
+	if ids[0].DestroySession(ids[0].key().handle()) { // calling the tested function
+		t.Error("The current session was deleted by its handle.")
+	}
+	// work check
+	if !ids[0].DestroySession(ids[1].key().handle()) { // calling the tested function
+		t.Error("The session was not deleted by its handle.")
+	}
+	// work check
+	if _, ok := ids[1].readS(); ok {
+		t.Error("The session was not deleted.")
+	}
+}
+
+func Test_Info(t *testing.T) {
+	id := generateId()
+	presently := time.Now().Unix()
+	allSessions[id] = internalSession{
+		expiration: presently + setingsSession.Expiration,
+		data:       make(Session),
+		created:    presently,
+		lastSeen:   presently,
+		ip:         "127.0.0.1",
+	}
+
+	info, ok := id.Info() // calling the tested function
+	// work check
+	if !ok || !info.Current || info.IP != "127.0.0.1" || info.Handle != id.key().handle() {
+		t.Errorf("Incorrect session description: %+v", info)
+	}
+
+	// work check
+	if _, ok := generateId().Info(); ok { // calling the tested function
+		t.Error("A description of a nonexistent session was received.")
+	}
+}
+
+func Test_limitUserLocked(t *testing.T) {
+	var evicted []SessionInfo
+	defer SetAuthSetings(AuthSetings{})
+
+	// reject the new login
+	SetAuthSetings(AuthSetings{MaxSessionsPerUser: 2, LimitPolicy: GOSESSION_LIMIT_REJECT})
+	userId := string(generateId())
+	loginTestUser(userId, 2)
+	var w http.ResponseWriter = httptest.NewRecorder()
+	id := generateId()
+	newId, err := id.Login(&w, userId) // calling the tested function
+	// work check
+	if err != ErrTooManySessions || newId != id || len(UserSessions(userId)) != 2 {
+		t.Error("The login over the limit was not rejected.")
+	}
+
+	// the sessions that are only in the store are counted
+	useTestStore(t, NewMemoryStore())
+	userId = string(generateId())
+	stored := loginTestUser(userId, 2)
+	restartMemory(stored)
+	_, err = generateId().Login(&w, userId) // calling the tested function
+	// work check
+	if err != ErrTooManySessions || len(UserSessions(userId)) != 2 {
+		t.Error("The login over the limit with the sessions of the store was not rejected.")
+	}
+	DestroyUserSessions(userId)
+
+	// evict the oldest and the least recently used sessions
+	policies := []SessionLimitPolicy{GOSESSION_LIMIT_EVICT_OLDEST, GOSESSION_LIMIT_EVICT_LRU}
+	for _, policy := range policies {
+		SetAuthSetings(AuthSetings{
+			MaxSessionsPerUser: 2,
+			LimitPolicy:        policy,
+			OnEvict: func(info SessionInfo) {
+				evicted = append(evicted, info)
+			},
+		})
+		evicted = nil
+		userId := string(generateId())
+		ids := loginTestUser(userId, 2)
+		presently := time.Now().Unix()
+		// the first session is the oldest, but it was used most recently
+		ids[0].updateS(func(ses *internalSession) {
+			ses.created = presently - 100
+			ses.lastSeen = presently
+		})
+		ids[1].updateS(func(ses *internalSession) {
+			ses.created = presently - 10
+			ses.lastSeen = presently - 50
+		})
+		expected := ids[0]
+		if policy == GOSESSION_LIMIT_EVICT_LRU {
+			expected = ids[1]
+		}
+
+		_, err := generateId().Login(&w, userId) // calling the tested function
+		// work check
+		if err != nil || len(UserSessions(userId)) != 2 {
+			t.Errorf("The limit of sessions was not kept, policy: %v", policy)
+		}
+		// work check
+		if _, ok := expected.readS(); ok || len(evicted) != 1 || evicted[0].Handle != expected.key().handle() {
+			t.Errorf("The wrong session was evicted, policy: %v", policy)
+		}
+	}
+}
+
+// ----------------------
+// Functions benchmarking
+// ----------------------
+
+func Benchmark_UserSessions(b *testing.B) {
+	userId := string(generateId())
+	loginTestUser(userId, 10)
+
+	for i := 0; i < b.N; i++ {
+		UserSessions(userId) // calling the tested function
+	}
+}